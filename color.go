@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// ANSI escapes for the colors gover uses.
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// colorWriter colors the messages written to w by how they start: errors
+// red, warnings yellow and success messages green. It expects one message
+// per Write, as the log package does.
+type colorWriter struct {
+	w io.Writer
+}
+
+func (c colorWriter) Write(p []byte) (int, error) {
+	var color string
+	switch {
+	case bytes.HasPrefix(p, []byte("gover: ")):
+		color = colorRed
+	case bytes.HasPrefix(p, []byte("WARNING")):
+		color = colorYellow
+	case bytes.HasPrefix(p, []byte("Success")):
+		color = colorGreen
+	default:
+		return c.w.Write(p)
+	}
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+	var b bytes.Buffer
+	b.WriteString(color)
+	b.Write(msg)
+	b.WriteString(colorReset)
+	b.Write(p[len(msg):])
+	if _, err := c.w.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// useColor reports whether output to f should be colored: only if f is a
+// terminal, and neither NO_COLOR (see https://no-color.org) nor
+// GOVER_NO_COLOR is set.
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("GOVER_NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// logOutput returns the writer for gover's log messages on f.
+func logOutput(f *os.File) io.Writer {
+	if useColor(f) {
+		return colorWriter{f}
+	}
+	return f
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// subcommands are the commands gover handles itself rather than passing to
+// a go toolchain.
+var subcommands = []string{"download", "list", "list-files", "search", "info", "remove", "prune", "use", "rename", "reinstall", "upgrade", "exec", "run", "verify", "which", "env", "clean", "clean-cache", "update-keys", "doctor", "completion"}
+
+const bashCompletion = `# bash completion for gover.
+# To load it in the current shell, run:
+#	source <(gover completion bash)
+# To load it for every session, add that line to ~/.bashrc.
+_gover() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "{{subcommands}} $(gover list 2>/dev/null | awk '{print $1}')" -- "$cur"))
+		return
+	fi
+	case ${COMP_WORDS[1]} in
+	download)
+		COMPREPLY=($(compgen -W "latest $(gover list --remote 2>/dev/null | awk '{print $1}')" -- "$cur"));;
+	remove|use|rename|reinstall|upgrade|exec|run|verify|which|env|info|list-files)
+		COMPREPLY=($(compgen -W "$(gover list 2>/dev/null | awk '{print $1}')" -- "$cur"));;
+	completion)
+		COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"));;
+	esac
+}
+complete -o default -F _gover gover
+`
+
+const zshCompletion = `#compdef gover
+# zsh completion for gover.
+# To load it in the current shell, run:
+#	source <(gover completion zsh)
+# To load it for every session, add that line to ~/.zshrc after compinit.
+_gover() {
+	local -a versions
+	if (( CURRENT == 2 )); then
+		versions=(${(f)"$(gover list 2>/dev/null | awk '{print $1}')"})
+		compadd -- {{subcommands}} $versions
+		return
+	fi
+	case ${words[2]} in
+	download)
+		versions=(${(f)"$(gover list --remote 2>/dev/null | awk '{print $1}')"})
+		compadd -- latest $versions;;
+	remove|use|rename|reinstall|upgrade|exec|run|verify|which|env|info|list-files)
+		versions=(${(f)"$(gover list 2>/dev/null | awk '{print $1}')"})
+		compadd -- $versions;;
+	completion)
+		compadd -- bash zsh fish;;
+	*)
+		_files;;
+	esac
+}
+compdef _gover gover
+`
+
+const fishCompletion = `# fish completion for gover.
+# To load it in the current shell, run:
+#	gover completion fish | source
+# To load it for every session, save it as ~/.config/fish/completions/gover.fish.
+complete -c gover -f -n '__fish_is_first_arg' -a '{{subcommands}}'
+complete -c gover -f -n '__fish_is_first_arg' -a '(gover list 2>/dev/null | string split -f1 " ")'
+complete -c gover -f -n '__fish_seen_subcommand_from download' -a 'latest (gover list --remote 2>/dev/null | string split -f1 " ")'
+complete -c gover -f -n '__fish_seen_subcommand_from remove use rename reinstall upgrade exec run verify which env info list-files' -a '(gover list 2>/dev/null | string split -f1 " ")'
+complete -c gover -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+`
+
+// completionScript returns the completion script for shell.
+func completionScript(shell string) (string, error) {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return "", fmt.Errorf("unsupported shell %q; choose bash, zsh or fish", shell)
+	}
+	return strings.ReplaceAll(script, "{{subcommands}}", strings.Join(subcommands, " ")), nil
+}
+
+// closestSubcommand returns the subcommand most likely meant by a mistyped
+// s, or the empty string if none is close.
+func closestSubcommand(s string) string {
+	best, bestDist := "", 3
+	for _, sc := range subcommands {
+		if d := editDistance(s, sc); d < bestDist {
+			best, bestDist = sc, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
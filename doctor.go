@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"suah.dev/gover/gover"
+)
+
+// doctorCheck is one item of the report printed by "gover doctor".
+type doctorCheck struct {
+	name string
+	// run returns a description of what it found, or an error.
+	run func() (string, error)
+	// hint tells how to fix a failure.
+	hint string
+	// optional marks checks whose failure only limits what gover can
+	// do, rather than stopping it from working.
+	optional bool
+}
+
+// doctor checks the environment gover runs in and prints a report. It
+// returns false if any required check failed.
+func doctor(root string) bool {
+	var latest string
+	checks := []doctorCheck{
+		{
+			name: "root",
+			run: func() (string, error) {
+				return root + " is writable", gover.CheckWritable(root)
+			},
+			hint: "make it writable, or set GOVER_ROOT to a directory that is",
+		},
+		{
+			name: "signing keys",
+			run: func() (string, error) {
+				return gover.CheckKeys(root)
+			},
+			hint: "run 'gover update-keys', or update gover, to get current release signing keys",
+		},
+		{
+			name: "release feed",
+			run: func() (string, error) {
+				// Bypass the cache to check the network.
+				releases, err := gover.Releases("", false)
+				if err != nil {
+					return "", err
+				}
+				for _, r := range releases {
+					if r.Stable {
+						latest = strings.TrimPrefix(r.Version, "go")
+						break
+					}
+				}
+				return fmt.Sprintf("reachable, latest release is %s", latest), nil
+			},
+			hint: "check your network and HTTPS_PROXY; downloads need an exact version without the feed",
+		},
+		{
+			name: "download host",
+			run: func() (string, error) {
+				var reachable []string
+				var err error
+				for _, base := range gover.DownloadURLs() {
+					if err = checkReachable(base); err == nil {
+						reachable = append(reachable, base)
+					}
+				}
+				if len(reachable) == 0 {
+					return "", err
+				}
+				return strings.Join(reachable, ", ") + " reachable", nil
+			},
+			hint: "check your network and HTTPS_PROXY, or set GOVER_DL_URL or GOVER_MIRRORS to a mirror you can reach",
+		},
+		{
+			name: "bootstrap toolchain",
+			run: func() (string, error) {
+				if latest == "" {
+					return "", fmt.Errorf("cannot tell which release to check for without the release feed")
+				}
+				gr, err := gover.FindBootstrap(root, latest)
+				if err != nil {
+					return "", err
+				}
+				if gr == "" {
+					return fmt.Sprintf("Go %s needs none", latest), nil
+				}
+				return fmt.Sprintf("%s can build Go %s", gr, latest), nil
+			},
+			hint:     "only needed to build from source; 'gover download --binary' needs none",
+			optional: true,
+		},
+		{
+			name: "C compiler",
+			run: func() (string, error) {
+				ccs := []string{"gcc", "clang", "cc"}
+				if cc := strings.Fields(os.Getenv("CC")); len(cc) > 0 {
+					ccs = cc[:1]
+				}
+				for _, cc := range ccs {
+					if p, err := exec.LookPath(cc); err == nil {
+						return p, nil
+					}
+				}
+				return "", fmt.Errorf("none of %s found", strings.Join(ccs, ", "))
+			},
+			hint:     "install gcc or clang, or set CC; toolchains built without one have cgo disabled",
+			optional: true,
+		},
+	}
+
+	paint := func(color, s string) string { return s }
+	if useColor(os.Stdout) {
+		paint = func(color, s string) string { return color + s + colorReset }
+	}
+	ok := true
+	for _, c := range checks {
+		detail, err := c.run()
+		switch {
+		case err == nil:
+			fmt.Printf("%s    %s: %s\n", paint(colorGreen, "ok"), c.name, detail)
+		case c.optional:
+			fmt.Printf("%s  %s: %v\n      %s\n", paint(colorYellow, "warn"), c.name, err, c.hint)
+		default:
+			fmt.Printf("%s  %s: %v\n      %s\n", paint(colorRed, "FAIL"), c.name, err, c.hint)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkReachable reports whether the server at u answers at all.
+func checkReachable(u string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", u+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := gover.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,94 @@
+package gover
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Alias makes alias another name for the installed version under
+// root, so that "gover ALIAS" runs it. Aliases are symlinks, like
+// "latest"; an existing alias is pointed at version instead.
+func Alias(root, version, alias string) error {
+	if runtime.GOOS == "plan9" {
+		return fmt.Errorf("cannot alias %s: %w", version, errNoSymlinks)
+	}
+	if err := checkAlias(alias); err != nil {
+		return err
+	}
+	if version == "" || strings.HasPrefix(version, ".") || strings.ContainsAny(version, `/\`) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	if _, err := os.Stat(filepath.Join(root, version, "go", "bin", "go"+Exe())); err != nil {
+		return fmt.Errorf("version %s is not installed. Run 'gover download %s' first", version, version)
+	}
+	// Point at what another alias points at, rather than at the alias,
+	// so that aliases stay put when that one is moved.
+	if tgt := aliasTarget(root, version); tgt != "" {
+		version = tgt
+	}
+	if version == alias {
+		return fmt.Errorf("%s cannot be an alias of itself", alias)
+	}
+	link := filepath.Join(root, alias)
+	if fi, err := os.Lstat(link); err == nil {
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s already exists and is not an alias", link)
+		}
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	}
+	if err := os.Symlink(version, link); err != nil {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("%v; creating symlinks on Windows requires Developer Mode or administrator rights", err)
+		}
+		return err
+	}
+	log.Printf("%s is now an alias of %s. Run it with 'gover %s'.", alias, version, alias)
+	return nil
+}
+
+// checkAlias returns an error unless alias can name a toolchain without
+// being mistaken for a version or one of gover's own entries. Callers
+// with commands of their own must keep aliases from shadowing those.
+func checkAlias(alias string) error {
+	switch {
+	case alias == "" || strings.HasPrefix(alias, ".") || strings.HasPrefix(alias, "-") || strings.ContainsAny(alias, `/\`+" "):
+		return fmt.Errorf("invalid alias %q", alias)
+	case alias == "latest" || alias == "current" || alias == "default":
+		return fmt.Errorf("alias %q is reserved by gover", alias)
+	}
+	if _, ok := parseVersion(alias); ok {
+		return fmt.Errorf("alias %q looks like a version", alias)
+	}
+	return nil
+}
+
+// aliasesOf returns the names of the aliases under root that point at
+// version.
+func aliasesOf(root, version string) []string {
+	var aliases []string
+	entries, _ := os.ReadDir(root)
+	for _, entry := range entries {
+		if aliasTarget(root, entry.Name()) == version {
+			aliases = append(aliases, entry.Name())
+		}
+	}
+	return aliases
+}
+
+// aliasTarget returns the name of the toolchain that the alias name under
+// root points at, or "" if name is no alias. Toolchains installed elsewhere
+// with InstallOptions.Dest are symlinks too, but to an absolute path, and
+// are no aliases.
+func aliasTarget(root, name string) string {
+	tgt, err := os.Readlink(filepath.Join(root, name))
+	if err != nil || filepath.IsAbs(tgt) {
+		return ""
+	}
+	return tgt
+}
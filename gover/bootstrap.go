@@ -0,0 +1,102 @@
+package gover
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// minBootstrap returns the oldest Go release able to bootstrap target, and
+// false if target is old enough to be built with a C compiler alone.
+// See https://go.dev/doc/install/source#bootstrapFromBinaryRelease.
+func minBootstrap(target goVersion) (goVersion, bool) {
+	switch {
+	case target.major == 1 && target.minor < 5:
+		return goVersion{}, false
+	case target.major == 1 && target.minor < 20:
+		return goVersion{major: 1, minor: 4}, true
+	case target.major == 1 && target.minor < 22:
+		return goVersion{major: 1, minor: 17, patch: 13}, true
+	default:
+		// Since Go 1.22, every other release requires the final patch
+		// of the release from a year earlier.
+		minor := target.minor - target.minor%2 - 2
+		return goVersion{major: target.major, minor: minor, patch: 6}, true
+	}
+}
+
+// FindBootstrap returns a GOROOT suitable for GOROOT_BOOTSTRAP when building
+// version. A GOROOT_BOOTSTRAP already set in the environment is used as is.
+// Otherwise the candidates are the go command on PATH and the toolchains
+// installed under root; the oldest one recent enough to build version is
+// picked, as it is the one the Go release was tested with. It returns the
+// empty string if version needs no bootstrap toolchain.
+func FindBootstrap(root, version string) (string, error) {
+	if gr := os.Getenv("GOROOT_BOOTSTRAP"); gr != "" {
+		return gr, nil
+	}
+	target, ok := parseVersion(version)
+	if !ok {
+		// Leave it to the make script to find one.
+		return "", nil
+	}
+	need, ok := minBootstrap(target)
+	if !ok {
+		return "", nil
+	}
+
+	type candidate struct {
+		goroot  string
+		version goVersion
+	}
+	var best *candidate
+	consider := func(gr string, v goVersion) {
+		if v.less(need) || !v.less(target) {
+			// Too old, or newer than the version being built; the
+			// latter generally works but isn't what the release was
+			// tested with, so only the go on PATH is used like that,
+			// as a last resort.
+			return
+		}
+		if best == nil || v.less(best.version) {
+			best = &candidate{gr, v}
+		}
+	}
+
+	entries, _ := os.ReadDir(root)
+	for _, entry := range entries {
+		v, ok := parseVersion(entry.Name())
+		if !ok || entry.Name() == version {
+			continue
+		}
+		gr := filepath.Join(root, entry.Name(), "go")
+		if _, err := os.Stat(filepath.Join(gr, "bin", "go"+Exe())); err == nil {
+			consider(gr, v)
+		}
+	}
+
+	var sysRoot string
+	if out, err := exec.Command("go", "env", "GOROOT", "GOVERSION").Output(); err == nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		sysRoot = strings.TrimSpace(lines[0])
+		if len(lines) > 1 {
+			if v, ok := parseVersion(strings.TrimSpace(lines[1])); ok {
+				if v.less(need) {
+					sysRoot = ""
+				} else {
+					consider(sysRoot, v)
+				}
+			}
+		}
+	}
+
+	switch {
+	case best != nil:
+		return best.goroot, nil
+	case sysRoot != "":
+		return sysRoot, nil
+	}
+	return "", fmt.Errorf("building Go %s requires Go %s or newer to bootstrap, but none was found; install one with 'gover download --binary %s' or set GOROOT_BOOTSTRAP", version, need, need)
+}
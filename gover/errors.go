@@ -0,0 +1,44 @@
+package gover
+
+import (
+	"context"
+	"errors"
+)
+
+// The kinds of failure an error returned by gover may be classified as,
+// for callers to tell apart with errors.Is. Errors of no particular kind
+// match none of them.
+var (
+	// ErrNetwork is a failure to download something, such as an archive,
+	// its signature or the release feed. Trying again later may help.
+	ErrNetwork = errors.New("network failure")
+	// ErrVerification is an archive or toolchain that does not match its
+	// signature or checksum.
+	ErrVerification = errors.New("verification failure")
+	// ErrBuild is a failure to build a toolchain from source or to run it
+	// afterwards.
+	ErrBuild = errors.New("build failure")
+)
+
+// kindError classifies err as kind, without changing its message.
+type kindError struct {
+	kind, err error
+}
+
+func (e *kindError) Error() string        { return e.err.Error() }
+func (e *kindError) Unwrap() error        { return e.err }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// withKind classifies err as kind, unless it is nil or already classified.
+// Cancellation is never classified, as it is no failure of its own.
+func withKind(kind, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	for _, k := range []error{ErrNetwork, ErrVerification, ErrBuild} {
+		if errors.Is(err, k) {
+			return err
+		}
+	}
+	return &kindError{kind, err}
+}
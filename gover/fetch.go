@@ -0,0 +1,569 @@
+package gover
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// HTTPTimeout bounds how long connecting, waiting for a response, or a
+// stalled download may take. It is set from GOVER_HTTP_TIMEOUT; zero
+// disables it. There is deliberately no limit on the download as a whole,
+// which may legitimately take long on a slow link.
+var HTTPTimeout = 30 * time.Second
+
+// TLSMinVersion is the oldest TLS version clients made by NewHTTPClient
+// accept. It is set from GOVER_TLS_MIN_VERSION.
+var TLSMinVersion uint16 = tls.VersionTLS12
+
+// Proxy, if set, is the proxy clients made by NewHTTPClient send all
+// requests through, instead of the one named by the HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY environment variables. It is set from GOVER_PROXY.
+var Proxy *url.URL
+
+// HTTPClient is used for all network access. Sharing it lets the archive,
+// its signature and the release feed reuse connections to the same host.
+var HTTPClient = NewHTTPClient(HTTPTimeout)
+
+// NewHTTPClient returns a client that gives up on connections and responses
+// that take longer than timeout to arrive, and only follows redirects that
+// stay on the same host (see checkRedirect). It keeps connections alive for
+// reuse, and speaks HTTP/2 where the server does.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	proxy := http.ProxyFromEnvironment
+	if Proxy != nil {
+		proxy = http.ProxyURL(Proxy)
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSClientConfig:       &tls.Config{MinVersion: TLSMinVersion},
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect allows redirects to the host first asked, and never from
+// HTTPS to plain HTTP. Redirects elsewhere tend to end at login or error
+// pages of captive portals and CDNs rather than at the file asked for.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	first := via[0].URL
+	if req.URL.Host != first.Host {
+		return fmt.Errorf("refusing redirect from %s to another host, %s", first, req.URL)
+	}
+	if first.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing redirect from %s to insecure %s", first, req.URL)
+	}
+	debugf("following redirect to %s", req.URL)
+	return nil
+}
+
+// dlBaseURL returns the URL archives are downloaded from. It defaults to
+// https://dl.google.com/go and may be pointed at a mirror with GOVER_DL_URL.
+// Archives are verified against the embedded key wherever they come from.
+func dlBaseURL() string {
+	if u := os.Getenv("GOVER_DL_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://dl.google.com/go"
+}
+
+// DownloadURLs returns the URLs to try downloading archives from, in order:
+// dlBaseURL, then the fallback mirrors listed in GOVER_MIRRORS, separated
+// by commas.
+func DownloadURLs() []string {
+	urls := []string{dlBaseURL()}
+	for _, u := range strings.Split(os.Getenv("GOVER_MIRRORS"), ",") {
+		u = strings.TrimSuffix(strings.TrimSpace(u), "/")
+		if u != "" && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// fetch downloads a into the file b and returns it, rewound, along with the
+// hex encoded SHA256 of its contents, reporting its progress to out.
+// Transient failures are retried up to
+// GOVER_RETRIES times (default 3), resuming the partial download when the
+// server supports range requests.
+//
+// The download is written to b.part and only renamed to b once complete,
+// so b never holds a truncated file. A b.part left by an interrupted run
+// is resumed.
+func fetch(ctx context.Context, a, b string, out io.Writer) (*os.File, string, error) {
+	fmt.Fprintf(out, "Fetching %q\n", a)
+	part := b + partSuffix
+	// Only the user needs to read downloads.
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, "", err
+	}
+	// A part left by an older gover may be readable by others.
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+
+	attempts := 3
+	if r := os.Getenv("GOVER_RETRIES"); r != "" {
+		if attempts, err = strconv.Atoi(r); err != nil || attempts < 1 {
+			f.Close()
+			return nil, "", fmt.Errorf("invalid GOVER_RETRIES %q", r)
+		}
+	}
+	for i := 1; ; i++ {
+		retry, err := fetchOnce(ctx, a, f, out)
+		if err == nil {
+			break
+		}
+		if !retry || i >= attempts {
+			f.Close()
+			// Keep partial data around for resuming, but not an
+			// empty file from a request that failed outright.
+			if fi, serr := os.Stat(part); serr == nil && fi.Size() == 0 {
+				_ = os.Remove(part)
+			}
+			return nil, "", withKind(ErrNetwork, err)
+		}
+		// Exponential backoff with up to 50% jitter.
+		d := time.Second << (i - 1)
+		d += time.Duration(rand.Int63n(int64(d / 2)))
+		log.Printf("%v; retrying in %v", err, d.Round(time.Millisecond))
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			f.Close()
+			return nil, "", ctx.Err()
+		}
+	}
+
+	// Close before renaming, which Windows requires.
+	if err := f.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := os.Rename(part, b); err != nil {
+		return nil, "", err
+	}
+	return openExisting(b)
+}
+
+// partSuffix is appended to the name of files being downloaded.
+const partSuffix = ".part"
+
+// CleanStaleParts removes partial downloads in dir that have not been
+// touched for a day. More recent ones are left for fetch to resume.
+func CleanStaleParts(dir string) {
+	parts, _ := filepath.Glob(filepath.Join(dir, "*"+partSuffix))
+	for _, p := range parts {
+		if fi, err := os.Stat(p); err == nil && time.Since(fi.ModTime()) > 24*time.Hour {
+			if err := os.Remove(p); err == nil {
+				log.Printf("Removed stale partial download %s", p)
+			}
+		}
+	}
+}
+
+// downloadSize returns the size of the file at u as reported by the
+// server, or -1 if it does not say.
+func downloadSize(ctx context.Context, u string) int64 {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", u, nil)
+	if err != nil {
+		return -1
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		debugf("cannot tell the size of %s: %v", u, err)
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// errNotFound is wrapped by the errors of downloads the server does not
+// have.
+var errNotFound = errors.New("does this version exist?")
+
+// fetchOnce makes a single attempt at downloading a into f, continuing
+// from the end of f if it already holds part of the file. It reports whether
+// a failure is worth retrying.
+func fetchOnce(parent context.Context, a string, f *os.File, out io.Writer) (bool, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", a, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	debugf("GET %s (Range: %q)", a, req.Header.Get("Range"))
+	fResp, err := HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	debugf("%s: %s, Content-Length %d", a, fResp.Status, fResp.ContentLength)
+	if u := fResp.Request.URL.String(); u != a {
+		debugf("%s resolved to %s", a, u)
+	}
+
+	defer fResp.Body.Close()
+
+	switch {
+	case fResp.StatusCode == http.StatusPartialContent && offset > 0:
+		log.Printf("Resuming download at byte %d", offset)
+	case fResp.StatusCode == http.StatusOK, fResp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The server ignored or rejected our range; start over.
+		if err := f.Truncate(0); err != nil {
+			return false, err
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			return false, err
+		}
+		if fResp.StatusCode != http.StatusOK {
+			return true, fmt.Errorf("fetching %s: HTTP %s", a, fResp.Status)
+		}
+		offset = 0
+	case fResp.StatusCode == http.StatusNotFound:
+		return false, fmt.Errorf("fetching %s: HTTP %s; %w", a, fResp.Status, errNotFound)
+	case fResp.StatusCode >= 500:
+		return true, fmt.Errorf("fetching %s: HTTP %s", a, fResp.Status)
+	default:
+		return false, fmt.Errorf("fetching %s: HTTP %s", a, fResp.Status)
+	}
+
+	// Archives and signatures are never web pages; an HTML response is
+	// an error page, such as a proxy's or a captive portal's, that
+	// happens to come with a success status.
+	if ct, _, _ := mime.ParseMediaType(fResp.Header.Get("Content-Type")); ct == "text/html" {
+		return true, fmt.Errorf("fetching %s: got an HTML page instead of the file; is a proxy or captive portal in the way?", fResp.Request.URL)
+	}
+
+	total := int64(-1)
+	if fResp.ContentLength >= 0 {
+		total = offset + fResp.ContentLength
+	}
+	EmitProgress(ProgressEvent{Event: "download_started", URL: a, Bytes: offset, Total: knownSize(total)})
+	pw := newProgressWriter(out, a, total)
+	pw.n = offset
+	body := io.Reader(fResp.Body)
+	if HTTPTimeout > 0 {
+		t := time.AfterFunc(HTTPTimeout, cancel)
+		defer t.Stop()
+		body = &stallReader{r: fResp.Body, t: t, d: HTTPTimeout}
+	}
+	n, err := io.Copy(io.MultiWriter(f, pw), body)
+	pw.done()
+	if err != nil && ctx.Err() != nil && parent.Err() == nil {
+		return true, fmt.Errorf("fetching %s: no data received for %v", a, HTTPTimeout)
+	}
+	if err != nil {
+		return true, err
+	}
+	if fResp.ContentLength >= 0 && n != fResp.ContentLength {
+		return true, fmt.Errorf("download of %s truncated: got %d of %d bytes", a, offset+n, total)
+	}
+	EmitProgress(ProgressEvent{Event: "download_done", URL: a, Bytes: offset + n})
+	return false, nil
+}
+
+// stallReader resets t to fire after d on every read, so that it only
+// fires once r has made no progress for d.
+type stallReader struct {
+	r io.Reader
+	t *time.Timer
+	d time.Duration
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.t.Reset(s.d)
+	return n, err
+}
+
+// fetchVerified downloads the archive at the first of goURLs that serves a
+// copy passing verification, and its signature, to fp and fp.asc. It checks
+// the archive against sum (if set) and the signing keys, and returns it
+// rewound. An archive and signature already present at fp are reused if
+// they pass the same checks, and downloaded again otherwise.
+func fetchVerified(ctx context.Context, root string, goURLs []string, fp string, sum string) (*os.File, error) {
+	kr, err := keyRing(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if tbz, tbzSum, err := openExisting(fp); err == nil {
+		sig, _, err := openExisting(fp + ".asc")
+		if errors.Is(err, fs.ErrNotExist) {
+			// Only the signature is missing, as when a mirror had
+			// not published it yet; fetch just that.
+			for _, goURL := range goURLs {
+				if sig, err = fetchSignature(ctx, goURL, fp); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				tbz.Close()
+				return nil, err
+			}
+		}
+		if err == nil {
+			err = verifyArchive(kr, tbz, tbzSum, sig, sum, path.Base(fp))
+			sig.Close()
+		}
+		if err == nil {
+			log.Printf("Using cached %s", fp)
+			return tbz, nil
+		}
+		tbz.Close()
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Cached %s is unusable (%v); downloading it again", fp, err)
+		}
+	}
+
+	// A mirror without the signature yet leaves what it got of the
+	// archive for the next mirror to resume. If no mirror has it, that is
+	// the error, as it tells that the download may simply be retried,
+	// unless another mirror served something failing verification.
+	var noSig, failed error
+	for i, goURL := range goURLs {
+		if i > 0 {
+			log.Printf("%v; trying the next mirror", err)
+		}
+		var tbz *os.File
+		tbz, err = fetchFrom(ctx, kr, goURL, fp, sum)
+		if err == nil {
+			if len(goURLs) > 1 {
+				log.Printf("Downloaded %s", goURL)
+			}
+			return tbz, nil
+		}
+		switch {
+		case errors.Is(err, errNoSignature):
+			noSig = err
+		case errors.Is(err, ErrVerification):
+			failed = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	switch {
+	case failed != nil:
+		return nil, failed
+	case noSig != nil:
+		return nil, noSig
+	}
+	return nil, err
+}
+
+// sigRetries is how many more times a signature that is not found is asked
+// for.
+const sigRetries = 3
+
+// errNoSignature is wrapped by the error of fetchSignature if there is no
+// signature to be found.
+var errNoSignature = errors.New("signature not yet available")
+
+// fetchSignature downloads the signature of the archive at goURL to fp.asc
+// and returns it. Mirrors sometimes publish signatures a little after the
+// archives, so a missing signature is asked for again a few times, waiting
+// longer each time, before giving up.
+func fetchSignature(ctx context.Context, goURL, fp string) (*os.File, error) {
+	for i := 1; ; i++ {
+		// The signature is fetched alongside the archive; keep it
+		// from printing over the archive's progress.
+		sig, _, err := fetch(ctx, goURL+".asc", fp+".asc", io.Discard)
+		if err == nil {
+			return sig, nil
+		}
+		if !errors.Is(err, errNotFound) {
+			return nil, fmt.Errorf("failed to download signature: %w", err)
+		}
+		if i > sigRetries {
+			return nil, withKind(ErrNetwork, fmt.Errorf("%w for %s; what was downloaded of the archive is kept for the next attempt", errNoSignature, path.Base(fp)))
+		}
+		d := time.Duration(i) * 10 * time.Second
+		log.Printf("No signature for %s yet; asking again in %v", path.Base(fp), d)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fetchUnverified is like fetchVerified, but only checks the archive
+// against sum, if set, and not its signature. It is only for
+// --insecure-skip-verify.
+func fetchUnverified(ctx context.Context, goURLs []string, fp string, sum string) (*os.File, error) {
+	checkSum := func(tbz *os.File, tbzSum string) (*os.File, error) {
+		if sum != "" && !strings.EqualFold(sum, tbzSum) {
+			tbz.Close()
+			_ = os.Remove(fp)
+			return nil, withKind(ErrVerification, fmt.Errorf("SHA256 mismatch for %s: expected %s, got %s", path.Base(fp), sum, tbzSum))
+		}
+		return tbz, nil
+	}
+	if tbz, tbzSum, err := openExisting(fp); err == nil {
+		log.Printf("Using cached %s", fp)
+		return checkSum(tbz, tbzSum)
+	}
+	var err error
+	for i, goURL := range goURLs {
+		if i > 0 {
+			log.Printf("%v; trying the next mirror", err)
+		}
+		var tbz *os.File
+		var tbzSum string
+		if tbz, tbzSum, err = fetch(ctx, goURL, fp, humanOut()); err == nil {
+			return checkSum(tbz, tbzSum)
+		}
+		err = fmt.Errorf("failed to download: %w", err)
+	}
+	return nil, err
+}
+
+// fetchFrom downloads goURL and its signature to fp and fp.asc and verifies
+// them as described for fetchVerified. Files failing verification are
+// removed, so that they are not resumed from another mirror.
+//
+// The signature is downloaded alongside the archive, and if it cannot be
+// had, the archive download stops early, leaving what it got to be resumed.
+func fetchFrom(ctx context.Context, kr openpgp.KeyRing, goURL, fp, sum string) (*os.File, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg     sync.WaitGroup
+		sig    *os.File
+		sigErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if sig, sigErr = fetchSignature(ctx, goURL, fp); sigErr != nil {
+			cancel()
+		}
+	}()
+	tbz, tbzSum, err := fetch(ctx, goURL, fp, humanOut())
+	if err != nil {
+		// No use waiting for the signature of an archive we lack.
+		cancel()
+	}
+	wg.Wait()
+	if sig != nil {
+		defer sig.Close()
+	}
+	// Whichever failed first canceled the other.
+	switch {
+	case sigErr != nil && !errors.Is(sigErr, context.Canceled):
+		if tbz != nil {
+			tbz.Close()
+		}
+		return nil, sigErr
+	case err != nil:
+		return nil, fmt.Errorf("failed to download: %w", err)
+	case sigErr != nil:
+		tbz.Close()
+		return nil, sigErr
+	}
+
+	if err := verifyArchive(kr, tbz, tbzSum, sig, sum, path.Base(fp)); err != nil {
+		tbz.Close()
+		_ = os.Remove(fp)
+		_ = os.Remove(fp + ".asc")
+		return nil, fmt.Errorf("failed to verify: %w", err)
+	}
+	return tbz, nil
+}
+
+// openExisting opens the previously downloaded file fp and returns it along
+// with the hex encoded SHA256 of its contents.
+func openExisting(fp string) (*os.File, string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	return f, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CacheDir returns the directory downloaded archives are kept in, so that
+// retries and reinstalls don't download them again. It is $GOVER_CACHE if
+// set, and root/.cache otherwise.
+func CacheDir(root string) string {
+	if dir := os.Getenv("GOVER_CACHE"); dir != "" {
+		return dir
+	}
+	return filepath.Join(root, ".cache")
+}
+
+// CleanCache removes every file from the archive cache.
+func CleanCache(root string) error {
+	dir := CacheDir(root)
+	size, err := dirSize(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	log.Printf("Removed cached archives from %s (%s freed)", dir, HumanBytes(size))
+	return nil
+}
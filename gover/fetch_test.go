@@ -0,0 +1,45 @@
+package gover
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFetchMode(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("no Unix permissions on " + runtime.GOOS)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("archive"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	for _, name := range []string{"new.tar.gz", "resumed.tar.gz"} {
+		fp := filepath.Join(dir, name)
+		if name == "resumed.tar.gz" {
+			// A partial download left readable by an older gover.
+			if err := os.WriteFile(fp+partSuffix, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, _, err := fetch(context.Background(), srv.URL+"/"+name, fp, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		fi, err := os.Stat(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != 0600 {
+			t.Errorf("%s: mode %v, want %v", name, got, os.FileMode(0600))
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package gover downloads, verifies, builds and runs Go release toolchains,
+// as the gover command does. Toolchains live in directories named after
+// their version under a root, by default the one returned by DefaultRoot:
+//
+//	root, err := gover.DefaultRoot()
+//	if err != nil {
+//		return err
+//	}
+//	if err := gover.Install(ctx, root, "1.21.0", gover.InstallOptions{}); err != nil {
+//		return err
+//	}
+//	cmd, err := gover.Command(ctx, root, "1.21.0", "version")
+//
+// Functions report progress and problems through the log package. Errors
+// from failed downloads, verifications and builds match ErrNetwork,
+// ErrVerification and ErrBuild respectively under errors.Is.
+package gover
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Verbose enables debug logging, see debugf.
+var Verbose bool
+
+// debugf logs a message if Verbose is set.
+func debugf(format string, args ...interface{}) {
+	if Verbose {
+		log.Printf("debug: "+format, args...)
+	}
+}
+
+// dirSize returns the total size of the regular files under dir. Symlinks are
+// not followed.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+const caseInsensitiveEnv = runtime.GOOS == "windows"
+
+// Exe returns the suffix of executable files on this system: ".exe" on
+// Windows, and nothing elsewhere.
+func Exe() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// PathVar returns the name of the environment variable listing where to
+// look for commands: path on Plan 9, and PATH elsewhere.
+func PathVar() string {
+	if runtime.GOOS == "plan9" {
+		return "path"
+	}
+	return "PATH"
+}
+
+// errNoSymlinks is returned on Plan 9 by features that need symlinks.
+var errNoSymlinks = errors.New("this needs symlinks, which Plan 9 does not have")
+
+// DefaultRoot returns the directory holding the installed toolchains. It is
+// $GOVER_ROOT if set, and ~/sdk/gover otherwise, or $XDG_DATA_HOME/gover
+// where that applies.
+func DefaultRoot() (string, error) {
+	if dir := os.Getenv("GOVER_ROOT"); dir != "" {
+		if !filepath.IsAbs(dir) {
+			return "", fmt.Errorf("GOVER_ROOT must be an absolute path, got %q", dir)
+		}
+		return filepath.Clean(dir), nil
+	}
+	home, err := homedir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	dir := filepath.Join(home, "sdk", "gover")
+	// Follow the XDG base directory spec where it applies, but keep using
+	// ~/sdk if toolchains were already installed there.
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" && filepath.IsAbs(xdg) && usesXDG() {
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			return filepath.Join(xdg, "gover"), nil
+		}
+	}
+	return dir, nil
+}
+
+// usesXDG reports whether the host follows the XDG base directory spec.
+func usesXDG() bool {
+	switch runtime.GOOS {
+	case "darwin", "ios", "plan9", "windows":
+		return false
+	}
+	return true
+}
+
+// MkdirAll creates dir and its parents like os.MkdirAll, but reports an
+// error naming the culprit if one of them exists and is not a directory.
+func MkdirAll(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		return nil
+	}
+	for p := dir; ; p = filepath.Dir(p) {
+		if fi, serr := os.Stat(p); serr == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s is a file, not a directory; move it out of the way, or set GOVER_ROOT to use another directory", p)
+			}
+			break
+		}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	return err
+}
+
+// CheckWritable reports an error if files cannot be created in dir.
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".gover-write-test")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func homedir() (string, error) {
+	// os.UserHomeDir reads $home on plan9, %USERPROFILE% on windows and
+	// $HOME elsewhere, which unlike user.Current lets users override it
+	// (Issue 26463). Fall back to the user database if $HOME is unset.
+	dir, err := os.UserHomeDir()
+	if err == nil {
+		return dir, nil
+	}
+	if runtime.GOOS != "plan9" && runtime.GOOS != "windows" {
+		if u, uerr := user.Current(); uerr == nil && u.HomeDir != "" {
+			return u.HomeDir, nil
+		}
+	}
+	return "", err
+}
+
+// dedupEnv returns a copy of env with any duplicates removed, in favor of
+// later values.
+// Items are expected to be on the normal environment "key=value" form.
+// If caseInsensitive is true, the case of keys is ignored.
+//
+// This function is unnecessary when the binary is
+// built with Go 1.9+, but keep it around for now until Go 1.8
+// is no longer seen in the wild in common distros.
+//
+// This is copied verbatim from golang.org/x/build/envutil.Dedup at CL 10301
+// (commit a91ae26).
+func dedupEnv(caseInsensitive bool, env []string) []string {
+	out := make([]string, 0, len(env))
+	saw := map[string]int{} // to index in the array
+	for _, kv := range env {
+		eq := strings.Index(kv, "=")
+		if eq < 1 {
+			out = append(out, kv)
+			continue
+		}
+		k := kv[:eq]
+		if caseInsensitive {
+			k = strings.ToLower(k)
+		}
+		if dupIdx, isDup := saw[k]; isDup {
+			out[dupIdx] = kv
+		} else {
+			saw[k] = len(out)
+			out = append(out, kv)
+		}
+	}
+	return out
+}
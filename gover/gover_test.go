@@ -0,0 +1,25 @@
+package gover
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMkdirAllFile(t *testing.T) {
+	home := t.TempDir()
+	sdk := filepath.Join(home, "sdk")
+	if err := os.WriteFile(sdk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{sdk, filepath.Join(sdk, "gover"), filepath.Join(sdk, "gover", ".cache")} {
+		err := MkdirAll(dir)
+		if err == nil || !strings.Contains(err.Error(), sdk+" is a file") {
+			t.Errorf("MkdirAll(%s): got error %v, want one naming %s", dir, err, sdk)
+		}
+	}
+	if err := MkdirAll(filepath.Join(home, "other", "gover")); err != nil {
+		t.Errorf("MkdirAll beside the file: %v", err)
+	}
+}
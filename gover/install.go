@@ -0,0 +1,764 @@
+package gover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InstallOptions controls how Install obtains a toolchain.
+type InstallOptions struct {
+	// Binary requests the prebuilt archive for the host platform. If
+	// none is published, Install falls back to building from source.
+	Binary bool
+	// GOOS and GOARCH select the platform of a binary archive, for
+	// staging toolchains for other machines. They default to the host's.
+	// Such toolchains are installed under a platform-qualified name
+	// (see InstallName) and cannot be run by gover.
+	GOOS, GOARCH string
+	// From names a local archive to install instead of downloading one.
+	// It is verified if a signature is found next to it.
+	From string
+	// VerifyOnly stops after downloading and verifying the archive,
+	// which is left in the cache for a later install to reuse.
+	VerifyOnly bool
+	// KeepArchive keeps a downloaded archive and its signature in the
+	// cache after a successful install. By default they are removed then;
+	// after a failed one they always stay, so that a retry need not
+	// download them again.
+	KeepArchive bool
+	// Jobs, if positive, sets GOMAXPROCS for the build, which also bounds
+	// how many packages the bootstrap go command compiles in parallel.
+	// Otherwise the build uses every available CPU.
+	Jobs int
+	// Quiet holds back the output of the build unless it fails.
+	Quiet bool
+	// NoTests leaves the test suite in go/test and the testdata
+	// directories under go/src out of the toolchain, and NoDocs go/doc,
+	// to save space. Such a toolchain builds and runs programs as usual,
+	// but cannot run the full test suite of Go itself.
+	NoTests, NoDocs bool
+	// DownloadTimeout and BuildTimeout, if positive, bound how long
+	// downloading the archive and its signature, and running the make
+	// script, may take. They apply on top of the context given to Install.
+	DownloadTimeout, BuildTimeout time.Duration
+	// Checksum, if set, is the SHA256 the archive must have, in addition
+	// to being signed.
+	Checksum string
+	// MakeArgs are passed to the make script. Some, such as --dist-tool,
+	// stop the build early, so that the install fails its smoke test.
+	MakeArgs []string
+	// CC and CXX, if set, name the C and C++ compilers for the build and
+	// for cgo in the toolchain built, which then has cgo enabled.
+	// Otherwise the make script picks the system's default compiler.
+	CC, CXX string
+	// Dest, if set, is the absolute path of a directory to install into
+	// instead of root/version, which then becomes a symlink to it, so that
+	// gover finds it like any other install. Dest must not exist yet.
+	Dest string
+	// ConfirmDownload, if set, is asked before an archive is downloaded,
+	// with its size in bytes, or -1 if unknown. Unless it returns true,
+	// Install fails without downloading anything.
+	ConfirmDownload func(archive string, size int64) bool
+	// InsecureSkipVerify skips checking the signature of the archive.
+	// It is only ever set by the --insecure-skip-verify flag, never
+	// by configuration.
+	InsecureSkipVerify bool
+}
+
+// Install downloads version and, unless a binary archive was used, builds
+// it. Fresh installs are staged in a temporary directory next to their
+// destination, root/version or opts.Dest, that is only renamed to it once
+// everything succeeded, and removed otherwise, so a failed attempt never
+// leaves a half-installed version behind.
+// Installs lacking the completeMarker, such as those interrupted while being
+// rebuilt in place, are replaced by a fresh one.
+func Install(ctx context.Context, root, version string, opts InstallOptions) (err error) {
+	// version ends up in paths and URLs, so make sure it is nothing else.
+	if err := checkVersion(version); err != nil {
+		return err
+	}
+	if !IsHost(opts.GOOS, opts.GOARCH) && (!opts.Binary || opts.From != "") {
+		return fmt.Errorf("toolchains for other platforms can only be installed with --binary")
+	}
+	name := InstallName(version, opts.GOOS, opts.GOARCH)
+	dest := filepath.Join(root, name)
+	unlock, err := lockInstall(root, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var link string
+	if opts.Dest != "" && !opts.VerifyOnly {
+		if runtime.GOOS == "plan9" {
+			return fmt.Errorf("cannot install into %s: %w", opts.Dest, errNoSymlinks)
+		}
+		if !filepath.IsAbs(opts.Dest) {
+			return fmt.Errorf("destination %s is not an absolute path", opts.Dest)
+		}
+		if _, err := os.Lstat(dest); err == nil {
+			return fmt.Errorf("Go %s is already installed as %s; remove it first", version, dest)
+		}
+		if _, err := os.Lstat(opts.Dest); err == nil {
+			return fmt.Errorf("destination %s already exists", opts.Dest)
+		}
+		if err := CheckWritable(filepath.Dir(opts.Dest)); err != nil {
+			return fmt.Errorf("cannot install into %s: %v", opts.Dest, err)
+		}
+		link, dest = dest, filepath.Clean(opts.Dest)
+	}
+	if _, err := os.Stat(filepath.Join(dest, completeMarker)); err == nil && !opts.VerifyOnly {
+		if opts.Binary {
+			return nil
+		}
+		// Already installed; just rebuild it in place. Until that
+		// succeeds, the install counts as incomplete.
+		if err := os.Remove(filepath.Join(dest, completeMarker)); err != nil {
+			return err
+		}
+		if err := buildGo(ctx, root, version, dest, opts); err != nil {
+			return withKind(ErrBuild, err)
+		}
+		if err := smokeTest(dest, version); err != nil {
+			return withKind(ErrBuild, err)
+		}
+		return markComplete(dest)
+	}
+
+	if opts.InsecureSkipVerify {
+		fmt.Fprintf(log.Writer(), "WARNING: --insecure-skip-verify is set: the signature of Go %s is NOT checked!\nWARNING: only use this with archives from a source you trust.\n", version)
+	}
+
+	var tbz *os.File
+	// cached is the downloaded archive, to be removed from the cache
+	// once installed; archives given with From are never removed.
+	var cached string
+	if opts.From != "" && opts.InsecureSkipVerify {
+		var tbzSum string
+		if tbz, tbzSum, err = openExisting(opts.From); err != nil {
+			return err
+		}
+		if opts.Checksum != "" && !strings.EqualFold(opts.Checksum, tbzSum) {
+			tbz.Close()
+			return withKind(ErrVerification, fmt.Errorf("SHA256 mismatch for %s: expected %s, got %s", filepath.Base(opts.From), opts.Checksum, tbzSum))
+		}
+	} else if opts.From != "" {
+		tbz, err = openLocal(root, opts.From, opts.Checksum)
+		if err != nil {
+			return fmt.Errorf("failed to verify: %w", err)
+		}
+	} else {
+		file, binary, err := releaseArchive(root, version, opts)
+		if err != nil {
+			return err
+		}
+		archive, sum := file.Filename, file.SHA256
+		opts.Binary = binary
+		if opts.Checksum != "" {
+			if sum != "" && !strings.EqualFold(sum, opts.Checksum) {
+				return withKind(ErrVerification, fmt.Errorf("--checksum %s does not match the SHA256 of %s published on go.dev, %s", opts.Checksum, archive, sum))
+			}
+			sum = opts.Checksum
+		}
+		var goURLs []string
+		for _, base := range DownloadURLs() {
+			goURLs = append(goURLs, base+"/"+archive)
+		}
+
+		cache := CacheDir(root)
+		if err := MkdirAll(cache); err != nil {
+			return fmt.Errorf("failed to create cache directory: %v", err)
+		}
+		// Salvage an archive left in dest by an earlier version of
+		// gover; it is verified again before use.
+		for _, name := range []string{archive, archive + ".asc"} {
+			_ = os.Rename(filepath.Join(dest, name), filepath.Join(cache, name))
+		}
+
+		fp := filepath.Join(cache, archive)
+		if _, err := os.Stat(fp); err != nil {
+			size := file.Size
+			if size <= 0 {
+				size = downloadSize(ctx, goURLs[0])
+			}
+			if size > 0 {
+				fmt.Fprintf(humanOut(), "Downloading %s (%s)\n", archive, HumanBytes(size))
+			}
+			if opts.ConfirmDownload != nil && !opts.ConfirmDownload(archive, size) {
+				return fmt.Errorf("not downloading %s", archive)
+			}
+		}
+		// The clock starts once the download was agreed to.
+		dctx := ctx
+		if opts.DownloadTimeout > 0 {
+			var cancel context.CancelFunc
+			dctx, cancel = context.WithTimeout(ctx, opts.DownloadTimeout)
+			defer cancel()
+		}
+		t0 := time.Now()
+		if opts.InsecureSkipVerify {
+			tbz, err = fetchUnverified(dctx, goURLs, fp, sum)
+		} else {
+			tbz, err = fetchVerified(dctx, root, goURLs, fp, sum)
+		}
+		debugf("download and verification took %v", time.Since(t0))
+		if err != nil && dctx.Err() != nil && ctx.Err() == nil {
+			err = withKind(ErrNetwork, fmt.Errorf("gave up downloading %s after %v; what was downloaded is kept for the next attempt", archive, opts.DownloadTimeout))
+		}
+		if err != nil {
+			if opts.VerifyOnly && !errors.Is(err, errNoSignature) {
+				_ = os.Remove(fp)
+				_ = os.Remove(fp + ".asc")
+			}
+			return fmt.Errorf("Go %s: %w", version, err)
+		}
+		cached = fp
+	}
+	defer tbz.Close()
+	if opts.VerifyOnly {
+		// The archive stays in the cache for a later install to reuse.
+		return nil
+	}
+
+	// Stage next to dest, so that it can be renamed into place.
+	stage, err := os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create source directory: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("Cleaning up %s", stage)
+			_ = os.RemoveAll(stage)
+		}
+	}()
+
+	if opts.NoTests {
+		log.Printf("WARNING: leaving out the tests; this toolchain cannot run the full test suite of Go itself")
+	}
+	t0 := time.Now()
+	if err := untarGo(tbz, stage, strippedEntry(opts)); err != nil {
+		return err
+	}
+	debugf("extraction took %v", time.Since(t0))
+	if opts.From != "" {
+		// Only binary archives come with a go command.
+		_, err := os.Stat(filepath.Join(stage, "go", "bin", "go"+Exe()))
+		opts.Binary = err == nil
+	}
+	// Binary archives need no build step.
+	if !opts.Binary {
+		if err := buildGo(ctx, root, version, stage, opts); err != nil {
+			return withKind(ErrBuild, err)
+		}
+	}
+	// Toolchains for other platforms cannot be run here.
+	if IsHost(opts.GOOS, opts.GOARCH) {
+		if err := smokeTest(stage, version); err != nil {
+			return withKind(ErrBuild, err)
+		}
+	}
+	if err := markComplete(stage); err != nil {
+		return err
+	}
+	// MkdirTemp made the stage private to us; installed toolchains
+	// are for everyone to read.
+	if err := os.Chmod(stage, 0755); err != nil {
+		return err
+	}
+	// An install found without a marker, whether left incomplete or made
+	// by an older gover, stays until its replacement is ready.
+	if _, err := os.Lstat(dest); err == nil {
+		log.Printf("Replacing incomplete install at %s", dest)
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(stage, dest); err != nil {
+		return err
+	}
+	if link != "" {
+		if err := os.Symlink(dest, link); err != nil {
+			return fmt.Errorf("installed Go %s in %s, but cannot link it from %s: %v", version, dest, link, err)
+		}
+	}
+	if cached != "" && !opts.KeepArchive {
+		removeCached(cached)
+	}
+	return nil
+}
+
+// removeCached removes the archive fp and its signature from the cache.
+// Failing to is not worth failing the install over.
+func removeCached(fp string) {
+	for _, name := range []string{fp, fp + ".asc"} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("cannot remove %s from the cache: %v", filepath.Base(name), err)
+			continue
+		}
+		debugf("removed %s from the cache", filepath.Base(name))
+	}
+}
+
+// InstallPlan describes what Install would do, as worked out by
+// PlanInstall.
+type InstallPlan struct {
+	// Dest is where the toolchain is installed, and Link the symlink to
+	// it under root, if it is installed elsewhere.
+	Dest, Link string
+	// Installed is set if the toolchain is installed already. Install
+	// then rebuilds it in place, or does nothing for binary archives.
+	Installed bool
+	// Archive is the archive installed from, File what the release feed
+	// says about it, if anything, and URLs where it is downloaded from,
+	// unless Cached is set because it was downloaded before.
+	Archive string
+	File    File
+	URLs    []string
+	Cached  bool
+	// Binary is set if the archive is a binary one, which only needs
+	// extracting rather than building. Archives given with From are
+	// only told apart once extracted, so Binary is unset for them.
+	Binary bool
+	// Bootstrap is the GOROOT_BOOTSTRAP a build would use, if any.
+	Bootstrap string
+}
+
+// PlanInstall works out what Install would do with the same arguments,
+// without changing anything. Set Offline first to keep it from fetching the
+// release feed; without the feed, it assumes a binary archive asked for
+// exists.
+func PlanInstall(root, version string, opts InstallOptions) (InstallPlan, error) {
+	var plan InstallPlan
+	if err := checkVersion(version); err != nil {
+		return plan, err
+	}
+	if !IsHost(opts.GOOS, opts.GOARCH) && (!opts.Binary || opts.From != "") {
+		return plan, fmt.Errorf("toolchains for other platforms can only be installed with --binary")
+	}
+	plan.Dest = filepath.Join(root, InstallName(version, opts.GOOS, opts.GOARCH))
+	if opts.Dest != "" && !opts.VerifyOnly {
+		if !filepath.IsAbs(opts.Dest) {
+			return plan, fmt.Errorf("destination %s is not an absolute path", opts.Dest)
+		}
+		if _, err := os.Lstat(opts.Dest); err == nil {
+			return plan, fmt.Errorf("destination %s already exists", opts.Dest)
+		}
+		plan.Link, plan.Dest = plan.Dest, filepath.Clean(opts.Dest)
+	}
+	_, err := os.Stat(filepath.Join(plan.Dest, completeMarker))
+	plan.Installed = err == nil && !opts.VerifyOnly
+	if plan.Installed && opts.Binary {
+		return plan, nil
+	}
+	switch {
+	case plan.Installed:
+	case opts.From != "":
+		plan.Archive = opts.From
+	default:
+		file, binary, err := releaseArchive(root, version, opts)
+		if err != nil {
+			return plan, err
+		}
+		plan.Archive, plan.File, plan.Binary = file.Filename, file, binary
+		if _, err := os.Stat(filepath.Join(CacheDir(root), plan.Archive)); err == nil {
+			plan.Cached = true
+		} else {
+			for _, base := range DownloadURLs() {
+				plan.URLs = append(plan.URLs, base+"/"+plan.Archive)
+			}
+		}
+	}
+	if !plan.Binary && !opts.VerifyOnly {
+		if plan.Bootstrap, err = FindBootstrap(root, version); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// strippedEntry returns the function telling which archive entries opts
+// leaves out, or nil if it keeps them all.
+func strippedEntry(opts InstallOptions) func(name string) bool {
+	if !opts.NoTests && !opts.NoDocs {
+		return nil
+	}
+	return func(name string) bool {
+		switch {
+		case opts.NoDocs && (name == "go/doc" || strings.HasPrefix(name, "go/doc/")):
+			return true
+		case opts.NoTests && (name == "go/test" || strings.HasPrefix(name, "go/test/")):
+			return true
+		case opts.NoTests && strings.HasPrefix(name, "go/src/"):
+			return strings.HasSuffix(name, "/testdata") || strings.Contains(name, "/testdata/")
+		}
+		return false
+	}
+}
+
+// WarmCache primes the caches used by the toolchain in root/version, for
+// faster first builds on fresh machines: the build cache, by building the
+// standard library, and, if module is not empty, the module cache, with the
+// dependencies of the module in that directory.
+func WarmCache(ctx context.Context, root, version, module string) error {
+	env, err := Env(root, version)
+	if err != nil {
+		return err
+	}
+	run := func(dir string, args ...string) error {
+		cmd := exec.CommandContext(ctx, filepath.Join(root, version, "go", "bin", "go"+Exe()), args...)
+		cmd.Env = env
+		cmd.Dir = dir
+		cmd.Stdout = humanOut()
+		cmd.Stderr = os.Stderr
+		log.Printf("Running go %s", strings.Join(args, " "))
+		t0 := time.Now()
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("go %s: %v", strings.Join(args, " "), err)
+		}
+		debugf("go %s took %v", strings.Join(args, " "), time.Since(t0))
+		return nil
+	}
+	if err := run("", "build", "std"); err != nil {
+		return err
+	}
+	if module == "" {
+		return nil
+	}
+	return run(module, "mod", "download")
+}
+
+// completeMarker is the file in a version's directory that marks it as
+// completely installed. Without it, a go directory may be the remains of
+// an interrupted extraction or build, so Install starts over.
+const completeMarker = ".gover-complete"
+
+// IsInstalled reports whether the toolchain root/name is completely
+// installed.
+func IsInstalled(root, name string) bool {
+	_, err := os.Stat(filepath.Join(root, name, completeMarker))
+	return err == nil
+}
+
+// markComplete marks the toolchain in dir as completely installed.
+func markComplete(dir string) error {
+	return os.WriteFile(filepath.Join(dir, completeMarker), nil, 0644)
+}
+
+// smokeTest checks that the toolchain in dir/go runs and reports the
+// expected version.
+func smokeTest(dir, version string) error {
+	cmd := exec.Command(filepath.Join(dir, "go", "bin", "go"+Exe()), "version")
+	// Keep an inherited GOROOT or a go.mod in the current directory
+	// from making this run another toolchain.
+	cmd.Env = dedupEnv(caseInsensitiveEnv, append(os.Environ(), "GOROOT="+filepath.Join(dir, "go"), "GOTOOLCHAIN=local"))
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("installed go does not run: %v", err)
+	}
+	got := strings.TrimSpace(string(out))
+	if !strings.Contains(got+" ", " go"+version+" ") {
+		return fmt.Errorf("installed go reports %q, expected go%s", got, version)
+	}
+	log.Printf("Smoke test passed: %s", got)
+	return nil
+}
+
+// lockInstall keeps other gover processes from installing name under root
+// until the returned function is called. The lock is a file holding the
+// PID of its owner, so that a lock left behind by a gover that crashed or
+// was killed can be told apart and taken over.
+func lockInstall(root, name string) (func(), error) {
+	lock := lockFile(root, name)
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		pid, alive := lockOwner(lock)
+		if alive {
+			return nil, fmt.Errorf("install of %s already in progress (pid %s)", name, pid)
+		}
+		log.Printf("Taking over the lock on %s from gover (pid %s), which is gone", name, pid)
+		if err := os.Remove(lock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		// Should another gover have taken it over first, this fails
+		// like any other install in progress.
+		f, err = os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			pid, _ := lockOwner(lock)
+			return nil, fmt.Errorf("install of %s already in progress (pid %s)", name, pid)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintln(f, os.Getpid())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(lock)
+		return nil, err
+	}
+	debugf("locked %s", lock)
+	return func() { _ = os.Remove(lock) }, nil
+}
+
+// lockOwner returns the PID recorded in the lock file lock, and whether it
+// is held: by a process still running, or, for a lock whose PID is not
+// written yet, just created.
+func lockOwner(lock string) (string, bool) {
+	fi, err := os.Stat(lock)
+	if err != nil {
+		return "", false
+	}
+	b, _ := os.ReadFile(lock)
+	pid := strings.TrimSpace(string(b))
+	n, err := strconv.Atoi(pid)
+	if err != nil || n <= 0 {
+		return "unknown", time.Since(fi.ModTime()) < time.Minute
+	}
+	return pid, processAlive(n)
+}
+
+// lockFile returns the path of the lock lockInstall takes on name.
+func lockFile(root, name string) string {
+	return filepath.Join(root, "."+name+".lock")
+}
+
+// releaseArchive returns the archive to install version from, with its
+// SHA256 and size as published on go.dev, if known. If opts.Binary is set it
+// prefers the binary archive for the platform in opts, and reports whether
+// that is what it picked; only the host platform can fall back to building
+// from source.
+func releaseArchive(root, version string, opts InstallOptions) (File, bool, error) {
+	// Mirrors may be reachable when go.dev is not, so carry on
+	// without the feed; the signature is still checked.
+	releases, err := Releases(root, true)
+	if err != nil {
+		log.Printf("Unable to fetch the release feed, skipping checksum verification: %v", err)
+	}
+	archive := fmt.Sprintf("go%s.src.tar.gz", version)
+	binary := opts.Binary
+	if binary {
+		goos, goarch := opts.GOOS, opts.GOARCH
+		if goos == "" {
+			goos = runtime.GOOS
+		}
+		if goarch == "" {
+			goarch = runtime.GOARCH
+		}
+		binArchive := binaryArchive(version, goos, goarch)
+		if _, ok := releaseFile(releases, binArchive); ok || releases == nil {
+			archive = binArchive
+		} else if !IsHost(goos, goarch) {
+			return File{}, false, fmt.Errorf("no binary archive of %s for %s/%s", version, goos, goarch)
+		} else {
+			log.Printf("No binary archive of %s for %s/%s; building from source", version, goos, goarch)
+			binary = false
+		}
+	}
+	file, _ := releaseFile(releases, archive)
+	file.Filename = archive
+	return file, binary, nil
+}
+
+// buildGo runs the make script of the Go tree of version in dir/go.
+func buildGo(ctx context.Context, root, version, dir string, opts InstallOptions) error {
+	parent := ctx
+	if opts.BuildTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.BuildTimeout)
+		defer cancel()
+	}
+	script := filepath.Join(dir, "go", "src", makeScript())
+	if runtime.GOOS == "windows" {
+		// Batch files run through cmd.exe, which mangles a quoted
+		// path with spaces followed by quoted arguments; keep the root
+		// out of the command line by running it relative to cmd.Dir.
+		script = `.\` + makeScript()
+	}
+	cmd := exec.CommandContext(ctx, script, opts.MakeArgs...)
+	killGroupOnCancel(cmd)
+	// Don't wait long for anything left holding on to the output.
+	cmd.WaitDelay = 5 * time.Second
+	// Keep the end of stderr for the error, where it does not scroll
+	// past.
+	tail := &tailWriter{max: 20}
+	cmd.Stdout = humanOut()
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	var out bytes.Buffer
+	if opts.Quiet {
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+	}
+	cmd.Dir = filepath.Join(dir, "go", "src")
+	env := os.Environ()
+	inherited := len(env)
+	// Set GOROOT_BOOTSTRAP explicitly rather than relying on the make
+	// script's autodetection, which make.bat lacks (Issue 28641) and
+	// which only looks at the go command on PATH.
+	bootstrap, err := FindBootstrap(root, version)
+	if err != nil {
+		return err
+	}
+	if bootstrap != "" {
+		log.Printf("Bootstrapping with %s", bootstrap)
+		env = append(env, "GOROOT_BOOTSTRAP="+bootstrap)
+	}
+	if opts.Jobs > 0 {
+		env = append(env, "GOMAXPROCS="+strconv.Itoa(opts.Jobs))
+	}
+	for _, c := range []struct{ name, cc string }{{"CC", opts.CC}, {"CXX", opts.CXX}} {
+		if c.cc == "" {
+			continue
+		}
+		// Fail before spending time on a build that cannot use it.
+		if f := strings.Fields(c.cc); len(f) == 0 {
+			return fmt.Errorf("%s is empty", c.name)
+		} else if _, err := exec.LookPath(f[0]); err != nil {
+			return fmt.Errorf("cannot use %s %q: %v", c.name, c.cc, err)
+		}
+		env = append(env, c.name+"="+c.cc, "CGO_ENABLED=1")
+	}
+	cmd.Env = dedupEnv(caseInsensitiveEnv, env)
+	debugf("running %s in %s", cmd.Path, cmd.Dir)
+	debugf("build environment additions: %q", env[inherited:])
+	EmitProgress(ProgressEvent{Event: "build_started", Version: version})
+	t0 := time.Now()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil && parent.Err() == nil {
+			err = fmt.Errorf("gave up after %v", opts.BuildTimeout)
+		}
+		EmitProgress(ProgressEvent{Event: "build_done", Version: version, Error: err.Error()})
+		if opts.Quiet {
+			// Show what went wrong after all.
+			_, _ = os.Stderr.Write(out.Bytes())
+			return fmt.Errorf("failed to build go: %v", err)
+		}
+		if len(tail.lines) == 0 && len(tail.buf) == 0 {
+			return fmt.Errorf("failed to build go: %v", err)
+		}
+		return fmt.Errorf("failed to build go: %v; the build ended with:\n%s", err, tail)
+	}
+	debugf("build took %v", time.Since(t0))
+	EmitProgress(ProgressEvent{Event: "build_done", Version: version})
+	return nil
+}
+
+// tailWriter keeps the last max lines written to it.
+type tailWriter struct {
+	max   int
+	lines []string
+	buf   []byte // incomplete last line
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i < 0 {
+			break
+		}
+		t.lines = append(t.lines, string(t.buf[:i]))
+		t.buf = t.buf[i+1:]
+	}
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) String() string {
+	lines := t.lines
+	if len(t.buf) > 0 {
+		lines = append(lines[:len(lines):len(lines)], string(t.buf))
+	}
+	return "\t" + strings.Join(lines, "\n\t")
+}
+
+// Reinstall removes the toolchain installed as name under root, along
+// with its cached archives, and installs it afresh. Unless confirm is nil,
+// nothing is removed before confirm, given the toolchain's directory and
+// version, returns true. It returns the version reinstalled, which differs
+// from name if that is an alias.
+func Reinstall(ctx context.Context, root, name string, confirm func(dir, version string) bool, opts InstallOptions) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid version %q", name)
+	}
+	// Reinstall what an alias points at, leaving the alias in place.
+	if tgt := aliasTarget(root, name); tgt != "" {
+		name = tgt
+	}
+	dir := filepath.Join(root, name)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("version %s is not installed in %v", name, root)
+	}
+	// A toolchain installed elsewhere is reinstalled there.
+	if tgt, err := os.Readlink(dir); err == nil && filepath.IsAbs(tgt) {
+		dir, opts.Dest = tgt, tgt
+	}
+	version := name
+	if p, ok := StagedPlatform(name); ok {
+		version = name[:strings.LastIndex(name, ".")]
+		opts.GOOS, opts.GOARCH, _ = strings.Cut(p, "/")
+		opts.Binary = true
+	}
+	if err := checkVersion(version); err != nil {
+		return "", fmt.Errorf("%s is not a release and cannot be reinstalled", name)
+	}
+
+	if confirm != nil && !confirm(dir, version) {
+		return "", fmt.Errorf("not reinstalling %s", name)
+	}
+
+	if err := Remove(root, name); err != nil {
+		return "", err
+	}
+	if opts.Dest != "" {
+		if err := os.RemoveAll(opts.Dest); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %v", opts.Dest, err)
+		}
+	}
+	// Archives of the version, source and binary, and their signatures;
+	// not those of other versions, such as go1.20.1 for 1.20.
+	goos, goarch := opts.GOOS, opts.GOARCH
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	for _, archive := range []string{fmt.Sprintf("go%s.src.tar.gz", version), binaryArchive(version, goos, goarch)} {
+		for _, f := range []string{archive, archive + ".asc", archive + partSuffix, archive + ".asc" + partSuffix} {
+			f = filepath.Join(CacheDir(root), f)
+			if err := os.Remove(f); err == nil {
+				debugf("removed %s", f)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+	return version, Install(ctx, root, version, opts)
+}
+
+func makeScript() string {
+	switch runtime.GOOS {
+	case "plan9":
+		return "make.rc"
+	case "windows":
+		return "make.bat"
+	default:
+		return "make.bash"
+	}
+}
@@ -0,0 +1,586 @@
+package gover
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LinkLatest points the "latest" symlink under root at version. On Plan 9,
+// which has no symlinks, it only says so.
+func LinkLatest(root, version string) error {
+	if runtime.GOOS == "plan9" {
+		log.Printf("Plan 9 has no symlinks, so 'gover latest' is not set up; run 'gover %s' instead", version)
+		return nil
+	}
+	log.Println("Creating a symlink", filepath.Join(root, "latest"), "to", version)
+	// Ignore errors deleting the existing symlink; if there really
+	// is a problem, os.Symlink will error about it too.
+	_ = os.Remove(filepath.Join(root, "latest"))
+	return os.Symlink(version, filepath.Join(root, "latest"))
+}
+
+// Installed describes an entry of root, as printed by "list --json".
+type Installed struct {
+	Version   string    `json:"version"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Installed time.Time `json:"installed"`
+	// Target is set for symlinks such as "latest" to the version they
+	// point at.
+	Target string `json:"target,omitempty"`
+	// Platform is the GOOS/GOARCH the toolchain runs on, if asked for
+	// and known.
+	Platform string `json:"platform,omitempty"`
+	// Kind tells what the entry is: a toolchain, an alias such as
+	// "latest", or the version selected with Use.
+	Kind Kind `json:"kind"`
+}
+
+// Kind classifies the entries of the gover root.
+type Kind string
+
+const (
+	// KindToolchain is an installed toolchain. Those installed elsewhere
+	// with InstallOptions.Dest are links, and have a Target.
+	KindToolchain Kind = "toolchain"
+	// KindAlias is another name for a toolchain, such as "latest".
+	KindAlias Kind = "alias"
+	// KindCurrent is the toolchain selected with Use.
+	KindCurrent Kind = "current"
+)
+
+// List returns the toolchains and links under root, skipping
+// gover's own files.
+// Walking a toolchain to compute its size is slow, so it is only done if
+// withSize is set.
+func List(root string, withSize bool) ([]Installed, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var versions []Installed
+	for _, entry := range entries {
+		// Skip gover's own bookkeeping files
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		finfo, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		// Plain files, such as the default version, are settings.
+		if finfo.Mode().IsRegular() {
+			continue
+		}
+		v := Installed{
+			Version:   entry.Name(),
+			Path:      filepath.Join(root, entry.Name()),
+			Installed: finfo.ModTime(),
+			Kind:      KindToolchain,
+		}
+		switch {
+		case v.Version == "current":
+			v.Kind = KindCurrent
+			// Where "current" holds a wrapper rather than being a
+			// symlink, Current knows what it runs.
+			if v.Target, err = Current(root); err != nil {
+				return nil, err
+			}
+		case finfo.Mode()&os.ModeSymlink != 0:
+			if v.Target, err = os.Readlink(v.Path); err != nil {
+				return nil, err
+			}
+			if !filepath.IsAbs(v.Target) {
+				v.Kind = KindAlias
+			}
+		}
+		if v.Kind == KindToolchain && v.Target == "" && withSize {
+			if v.Size, err = dirSize(v.Path); err != nil {
+				return nil, err
+			}
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// Use points the "current" symlink under root at version, so that
+// root/current/go/bin can be put on PATH once and always hold the selected
+// toolchain. Where symlinks are unavailable (unprivileged Windows accounts,
+// and Plan 9), a wrapper script is written in its place.
+func Use(root, version string) error {
+	if _, err := os.Stat(filepath.Join(root, version, "go", "bin", "go"+Exe())); err != nil {
+		return fmt.Errorf("version %s is not installed. Run 'gover download %s' first", version, version)
+	}
+	link := filepath.Join(root, "current")
+	if err := os.RemoveAll(link); err != nil {
+		return err
+	}
+	if err := os.Symlink(version, link); err != nil {
+		if runtime.GOOS != "windows" && runtime.GOOS != "plan9" {
+			return err
+		}
+		if err := writeUseWrapper(root, version); err != nil {
+			return err
+		}
+	}
+	log.Printf("Now using %s. Add %s to your PATH to run it as 'go'.", version, filepath.Join(link, "go", "bin"))
+	return nil
+}
+
+// writeUseWrapper creates root/current/go/bin/go.cmd (an rc script named go
+// on Plan 9) running version, and records version in root/current/version
+// for Current.
+func writeUseWrapper(root, version string) error {
+	bin := filepath.Join(root, "current", "go", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		return err
+	}
+	gr := filepath.Join(root, version, "go")
+	wrapper := filepath.Join(bin, "go.cmd")
+	// Quoting keeps spaces and the likes of & in the paths literal; only
+	// % still needs escaping, by doubling it.
+	batch := func(s string) string { return strings.ReplaceAll(s, "%", "%%") }
+	script := fmt.Sprintf("@echo off\r\nset \"GOROOT=%s\"\r\n\"%s\" %%*\r\n", batch(gr), batch(filepath.Join(gr, "bin", "go"+Exe())))
+	if runtime.GOOS == "plan9" {
+		wrapper = filepath.Join(bin, "go")
+		quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+		script = fmt.Sprintf("#!/bin/rc\nGOROOT=%s\nexec %s $*\n", quote(gr), quote(filepath.Join(gr, "bin", "go")))
+	}
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, "current", "version"), []byte(version+"\n"), 0644)
+}
+
+// Current returns the version selected with "gover use", or the
+// empty string if there is none.
+func Current(root string) (string, error) {
+	link := filepath.Join(root, "current")
+	if tgt, err := os.Readlink(link); err == nil {
+		return tgt, nil
+	}
+	b, err := os.ReadFile(filepath.Join(link, "version"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Remove removes the toolchain installed as version under root. If version
+// is an alias, or a toolchain installed elsewhere with InstallOptions.Dest,
+// only the link goes, and the files it points at stay.
+func Remove(root, version string) error {
+	dir := filepath.Join(root, version)
+	if version == "" || version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("version %s is not installed in %v", version, root)
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		// Only the alias goes; the version it names stays.
+		tgt, _ := os.Readlink(dir)
+		if err := os.Remove(dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", version, err)
+		}
+		log.Printf("Removed %s, which pointed at %s", version, tgt)
+		return nil
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", version, err)
+	}
+	log.Printf("Removed %s (%s freed)", version, HumanBytes(size))
+	for _, alias := range aliasesOf(root, version) {
+		log.Printf("WARNING: %s still points at %s; remove it with 'gover remove %s'", alias, version, alias)
+	}
+	return nil
+}
+
+// InUse returns why removing the toolchain installed as name under root
+// could break something: it is selected with "gover use", run by the current
+// shell, run by another gover (see MarkInUse), or being installed by one;
+// the PID of that gover is given if known. It returns "" if nothing is known
+// to use it. Aliases are never in use, as removing one leaves its toolchain
+// alone.
+func InUse(root, name string) string {
+	if aliasTarget(root, name) != "" {
+		return ""
+	}
+	if cur, err := Current(root); err == nil && cur == name {
+		return "it is selected with 'gover use'"
+	}
+	if active := activeVersion(root); active == name || active == "current" && aliasTarget(root, active) == name {
+		return "it is the go this shell runs, judging by GOROOT or PATH"
+	}
+	if pid, held := lockOwner(lockFile(root, name)); held {
+		return fmt.Sprintf("gover (pid %s) is installing it", pid)
+	}
+	markers, _ := filepath.Glob(filepath.Join(root, "."+name+runMarker+"*"))
+	for _, m := range markers {
+		pid := strings.TrimPrefix(filepath.Base(m), "."+name+runMarker)
+		if n, err := strconv.Atoi(pid); err == nil && processAlive(n) {
+			return fmt.Sprintf("gover (pid %s) is running it", pid)
+		}
+	}
+	return ""
+}
+
+// runMarker is part of the name of the files MarkInUse leaves under the
+// root, ".NAME.run-PID".
+const runMarker = ".run-"
+
+// MarkInUse records that this process runs the toolchain installed as name
+// under root, or the one name is an alias of, so that InUse tells until the
+// returned function is called. Markers left by processes no longer running
+// are ignored, and removed by Clean.
+func MarkInUse(root, name string) func() {
+	if tgt := aliasTarget(root, name); tgt != "" {
+		name = tgt
+	}
+	marker := filepath.Join(root, "."+name+runMarker+strconv.Itoa(os.Getpid()))
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		// Only the safety check of remove depends on it.
+		debugf("cannot mark %s in use: %v", name, err)
+		return func() {}
+	}
+	return func() { _ = os.Remove(marker) }
+}
+
+// IsPattern reports whether s is a pattern for Matching rather than a
+// version.
+func IsPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[") || strings.Contains(s, "..")
+}
+
+// Matching returns the release versions installed under root that pattern
+// matches, newest first. The pattern is either a glob, as in "1.19.*", or
+// an inclusive range of versions, as in "1.19.0..1.20.5". Aliases never
+// match, nor do toolchains staged for other platforms, unless the pattern is
+// a glob naming a platform, as in "1.19.*.darwin-*".
+func Matching(root, pattern string) ([]string, error) {
+	match := func(name string, v goVersion) (bool, error) {
+		return filepath.Match(pattern, name)
+	}
+	// Versions have no "-", unlike the goos-goarch of platforms.
+	staged := strings.Contains(pattern, "-")
+	if lo, hi, ok := strings.Cut(pattern, ".."); ok {
+		staged = false
+		lv, lok := parseVersion(lo)
+		hv, hok := parseVersion(hi)
+		if !lok || !hok || hv.less(lv) {
+			return nil, fmt.Errorf("invalid version range %q; expected LOW..HIGH, as in 1.19.0..1.20.5", pattern)
+		}
+		match = func(_ string, v goVersion) (bool, error) {
+			return !v.less(lv) && !hv.less(v), nil
+		}
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	vers := map[string]goVersion{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		version := name
+		if _, ok := StagedPlatform(name); ok {
+			if !staged {
+				continue
+			}
+			version = name[:strings.LastIndex(name, ".")]
+		}
+		v, ok := parseVersion(version)
+		if !ok || strings.HasPrefix(name, "go") {
+			continue
+		}
+		ok, err := match(name, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		if ok {
+			names = append(names, name)
+			vers[name] = v
+		}
+	}
+	newestFirst(names, vers)
+	return names, nil
+}
+
+// newestFirst sorts names by their versions in vers, newest first.
+func newestFirst(names []string, vers map[string]goVersion) {
+	slices.SortFunc(names, func(a, b string) int {
+		if vers[b].less(vers[a]) {
+			return -1
+		}
+		if vers[a].less(vers[b]) {
+			return 1
+		}
+		return 0
+	})
+}
+
+// RemoveAll removes every toolchain under root except the one the current
+// shell uses, as reported by activeVersion, and unless force is set, those
+// InUse. Aliases of the toolchains removed go with them; aliases of those
+// kept, the download cache and gover's other files stay.
+func RemoveAll(root string, force bool) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	kept := map[string]bool{}
+	active := activeVersion(root)
+	if tgt := aliasTarget(root, active); tgt != "" {
+		active = tgt
+	} else if active == "current" {
+		// Without symlinks, "current" is a directory naming the version.
+		active, _ = Current(root)
+	}
+	var total int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !isToolchainName(name) || aliasTarget(root, name) != "" {
+			continue
+		}
+		why := ""
+		switch {
+		case name == active:
+			why = "it is the go this shell runs"
+		case !force:
+			why = InUse(root, name)
+		}
+		if why != "" {
+			log.Printf("Kept %s: %s", name, why)
+			kept[name] = true
+			continue
+		}
+		size := int64(0)
+		if fi, err := os.Lstat(filepath.Join(root, name)); err == nil && fi.IsDir() {
+			if size, err = dirSize(filepath.Join(root, name)); err != nil {
+				return err
+			}
+		}
+		// A toolchain installed elsewhere only loses its link.
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", name, err)
+		}
+		log.Printf("Removed %s", name)
+		total += size
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		tgt := aliasTarget(root, name)
+		if name == "current" && tgt == "" {
+			tgt, _ = Current(root)
+		}
+		if tgt == "" || kept[tgt] || !isToolchainName(tgt) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, tgt)); err == nil {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", name, err)
+		}
+		log.Printf("Removed %s, which pointed at %s", name, tgt)
+	}
+	log.Printf("%s freed", HumanBytes(total))
+	return nil
+}
+
+// Prune removes all but the keep newest release versions under
+// root. Versions in use, whether by the current shell, "gover use" or
+// a symlink such as "latest", are always kept, and unless force is set, so
+// are those InUse otherwise, as by another gover. If dryRun is set, it only
+// prints what it would remove.
+func Prune(root string, keep int, dryRun, force bool) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	inUse := map[string]bool{activeVersion(root): true}
+	if cur, err := Current(root); err == nil {
+		inUse[cur] = true
+	}
+	var names []string
+	vers := map[string]goVersion{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if tgt, err := os.Readlink(filepath.Join(root, name)); err == nil {
+			inUse[tgt] = true
+			continue
+		}
+		if v, ok := parseVersion(name); ok && !strings.HasPrefix(name, "go") {
+			names = append(names, name)
+			vers[name] = v
+		}
+	}
+	newestFirst(names, vers)
+	for i, name := range names {
+		if i < keep {
+			continue
+		}
+		why := ""
+		if !force {
+			why = InUse(root, name)
+		}
+		switch {
+		case inUse[name]:
+			log.Printf("Keeping %s, which is in use", name)
+		case why != "":
+			log.Printf("Keeping %s: %s", name, why)
+		case dryRun:
+			fmt.Printf("Would remove %s\n", name)
+		default:
+			if err := Remove(root, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Clean removes what failed or interrupted installs left under root: the
+// directories installs were staged in, toolchains that were never
+// completely installed or lack their go command, archives that older
+// versions of gover kept inside toolchains, and partial downloads, here and
+// in the cache. Archives completely downloaded to the cache are left to
+// CleanCache. It lists what it removes, or with dryRun only what it would.
+// Nothing is removed while an install under root is in progress, but the
+// locks of installs that were killed are.
+func Clean(root string, dryRun bool) error {
+	var leftovers []string
+	locks, _ := filepath.Glob(filepath.Join(root, ".*.lock"))
+	for _, lock := range locks {
+		if pid, held := lockOwner(lock); held {
+			return fmt.Errorf("an install is in progress (pid %s); try again once it is done", pid)
+		}
+		leftovers = append(leftovers, lock)
+	}
+	markers, _ := filepath.Glob(filepath.Join(root, ".*"+runMarker+"*"))
+	for _, m := range markers {
+		pid := m[strings.LastIndex(m, runMarker)+len(runMarker):]
+		if n, err := strconv.Atoi(pid); err == nil && !processAlive(n) {
+			leftovers = append(leftovers, m)
+		}
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name, p := entry.Name(), filepath.Join(root, entry.Name())
+		switch {
+		case strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp-") && entry.IsDir():
+			leftovers = append(leftovers, p)
+		case strings.HasSuffix(name, partSuffix):
+			leftovers = append(leftovers, p)
+		case !entry.IsDir():
+			// Symlinks, such as aliases, and gover's own files.
+		case isToolchainName(name):
+			if !usableToolchain(root, name) {
+				leftovers = append(leftovers, p)
+				continue
+			}
+			archives, _ := filepath.Glob(filepath.Join(p, "go*.tar.gz*"))
+			leftovers = append(leftovers, archives...)
+		}
+	}
+	parts, _ := filepath.Glob(filepath.Join(CacheDir(root), "*"+partSuffix))
+	leftovers = append(leftovers, parts...)
+
+	if len(leftovers) == 0 {
+		log.Printf("Nothing to clean up")
+		return nil
+	}
+	var total int64
+	for _, p := range leftovers {
+		size, _ := dirSize(p)
+		total += size
+		if dryRun {
+			fmt.Printf("Would remove %s (%s)\n", p, HumanBytes(size))
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", p, err)
+		}
+		log.Printf("Removed %s (%s)", p, HumanBytes(size))
+	}
+	if !dryRun {
+		log.Printf("%s freed", HumanBytes(total))
+	}
+	return nil
+}
+
+// usableToolchain reports whether the toolchain installed as name has a go
+// command and was completely installed. Older versions of gover did not
+// mark complete installs, so unmarked toolchains for the host count as
+// complete if they run as the version they are named after.
+func usableToolchain(root, name string) bool {
+	dir := filepath.Join(root, name)
+	exe := Exe()
+	p, staged := StagedPlatform(name)
+	if staged {
+		exe = ""
+		if strings.HasPrefix(p, "windows/") {
+			exe = ".exe"
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "go", "bin", "go"+exe)); err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	return IsInstalled(root, name) || staged || smokeTest(dir, name) == nil
+}
+
+// isToolchainName reports whether name is that of a toolchain directory,
+// named after its version, and, if staged, its platform (see InstallName).
+func isToolchainName(name string) bool {
+	if _, staged := StagedPlatform(name); staged {
+		return true
+	}
+	_, ok := parseVersion(name)
+	return ok && !strings.HasPrefix(name, "go")
+}
+
+// activeVersion returns the name of the version under root that the current
+// shell is using, judging by GOROOT and then PATH (as set up by "gover env").
+// It returns the empty string if no version under root is in use.
+func activeVersion(root string) string {
+	candidates := []string{os.Getenv("GOROOT")}
+	candidates = append(candidates, filepath.SplitList(os.Getenv("PATH"))...)
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, c)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return strings.Split(filepath.ToSlash(rel), "/")[0]
+	}
+	return ""
+}
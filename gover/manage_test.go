@@ -0,0 +1,53 @@
+package gover
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestMatching(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"1.18", "1.19", "1.19.1", "1.19.13", "1.20rc1", "1.20", "1.20.5", "1.21.0", "1.19.1.darwin-arm64", "1.20.5.linux-386", "go1.19.2", ".cache"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" && runtime.GOOS != "plan9" {
+		if err := os.Symlink("1.19.13", filepath.Join(root, "1.19.99")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"1.19.*", []string{"1.19.13", "1.19.1"}},
+		{"1.19*", []string{"1.19.13", "1.19.1", "1.19"}},
+		{"1.2?rc*", []string{"1.20rc1"}},
+		{"*", []string{"1.21.0", "1.20.5", "1.20", "1.20rc1", "1.19.13", "1.19.1", "1.19", "1.18"}},
+		{"1.19.*.darwin-*", []string{"1.19.1.darwin-arm64"}},
+		{"*-*", []string{"1.20.5.linux-386", "1.19.1.darwin-arm64"}},
+		{"1.19.1..1.20", []string{"1.20", "1.20rc1", "1.19.13", "1.19.1"}},
+		{"1.20rc1..1.20rc1", []string{"1.20rc1"}},
+		{"1.19.2..1.19.12", nil},
+		{"1.22.*", nil},
+	}
+	for _, tt := range tests {
+		got, err := Matching(root, tt.pattern)
+		if err != nil {
+			t.Errorf("Matching(%q): %v", tt.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Matching(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+	for _, pattern := range []string{"1.20..1.19", "1.19..latest", "1.19.[", "..1.20"} {
+		if _, err := Matching(root, pattern); err == nil {
+			t.Errorf("Matching(%q) succeeded, want an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gover
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// knownPlatforms are the GOOS/GOARCH pairs a Go toolchain can run on.
+var knownPlatforms = map[string]bool{
+	"aix/ppc64":       true,
+	"darwin/amd64":    true,
+	"darwin/arm64":    true,
+	"dragonfly/amd64": true,
+	"freebsd/386":     true,
+	"freebsd/amd64":   true,
+	"freebsd/arm":     true,
+	"freebsd/arm64":   true,
+	"illumos/amd64":   true,
+	"linux/386":       true,
+	"linux/amd64":     true,
+	"linux/arm":       true,
+	"linux/arm64":     true,
+	"linux/loong64":   true,
+	"linux/mips":      true,
+	"linux/mips64":    true,
+	"linux/mips64le":  true,
+	"linux/mipsle":    true,
+	"linux/ppc64":     true,
+	"linux/ppc64le":   true,
+	"linux/riscv64":   true,
+	"linux/s390x":     true,
+	"netbsd/386":      true,
+	"netbsd/amd64":    true,
+	"netbsd/arm":      true,
+	"netbsd/arm64":    true,
+	"openbsd/386":     true,
+	"openbsd/amd64":   true,
+	"openbsd/arm":     true,
+	"openbsd/arm64":   true,
+	"openbsd/ppc64":   true,
+	"openbsd/riscv64": true,
+	"plan9/386":       true,
+	"plan9/amd64":     true,
+	"plan9/arm":       true,
+	"solaris/amd64":   true,
+	"windows/386":     true,
+	"windows/amd64":   true,
+	"windows/arm64":   true,
+}
+
+// CheckPlatform reports an error if goos/goarch is not a known platform.
+func CheckPlatform(goos, goarch string) error {
+	if !knownPlatforms[goos+"/"+goarch] {
+		return fmt.Errorf("unknown platform %s/%s", goos, goarch)
+	}
+	return nil
+}
+
+// IsHost reports whether goos/goarch is the platform gover runs on. Empty
+// values stand for the host's.
+func IsHost(goos, goarch string) bool {
+	return (goos == "" || goos == runtime.GOOS) && (goarch == "" || goarch == runtime.GOARCH)
+}
+
+// binaryArchive returns the name of the binary release archive of version
+// for goos/goarch.
+func binaryArchive(version, goos, goarch string) string {
+	if goarch == "arm" {
+		// Only ARMv6 builds are published, under this name.
+		goarch = "armv6l"
+	}
+	return fmt.Sprintf("go%s.%s-%s.tar.gz", version, goos, goarch)
+}
+
+// InstallName returns the name of the directory under root holding version
+// for goos/goarch. Toolchains for the host use the plain version, so that
+// they can be run as "gover VERSION"; others are qualified with their
+// platform, as in 1.21.0.darwin-arm64.
+func InstallName(version, goos, goarch string) string {
+	if IsHost(goos, goarch) {
+		return version
+	}
+	return version + "." + goos + "-" + goarch
+}
+
+// StagedPlatform reports the platform of a toolchain directory named by
+// InstallName for a platform other than the host.
+func StagedPlatform(name string) (string, bool) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return "", false
+	}
+	if _, ok := parseVersion(name[:i]); !ok {
+		return "", false
+	}
+	p := strings.Replace(name[i+1:], "-", "/", 1)
+	return p, knownPlatforms[p]
+}
+
+// platformCacheFile caches the platforms found by toolchainPlatform under
+// root, since finding them may mean running every toolchain.
+const platformCacheFile = ".platforms.json"
+
+// cachedPlatform is an entry of platformCacheFile. It is only valid for the
+// toolchain last modified at Installed.
+type cachedPlatform struct {
+	Platform  string    `json:"platform"`
+	Installed time.Time `json:"installed"`
+}
+
+// AddPlatforms sets the Platform of each toolchain in versions, reusing and
+// updating the results cached under root.
+func AddPlatforms(root string, versions []Installed) {
+	cache := filepath.Join(root, platformCacheFile)
+	cached := map[string]cachedPlatform{}
+	if b, err := os.ReadFile(cache); err == nil {
+		_ = json.Unmarshal(b, &cached)
+	}
+	updated := map[string]cachedPlatform{}
+	for i, v := range versions {
+		if v.Target != "" {
+			continue
+		}
+		c, ok := cached[v.Version]
+		if !ok || !c.Installed.Equal(v.Installed) {
+			c = cachedPlatform{toolchainPlatform(v.Path), v.Installed}
+		}
+		versions[i].Platform = c.Platform
+		if c.Platform != "" {
+			updated[v.Version] = c
+		}
+	}
+	if b, err := json.Marshal(updated); err == nil {
+		// The cache is only an optimization; ignore failures to write it.
+		_ = os.WriteFile(cache, b, 0644)
+	}
+}
+
+// toolchainPlatform returns the GOOS/GOARCH the toolchain in dir/go runs
+// on, or "" if it cannot tell.
+func toolchainPlatform(dir string) string {
+	if p, ok := StagedPlatform(filepath.Base(dir)); ok {
+		return p
+	}
+	// Release archives and builds from source only hold the tools for
+	// their own platform, which saves running the go command.
+	var tools []string
+	entries, _ := os.ReadDir(filepath.Join(dir, "go", "pkg", "tool"))
+	for _, entry := range entries {
+		if p := strings.Replace(entry.Name(), "_", "/", 1); entry.IsDir() && knownPlatforms[p] {
+			tools = append(tools, p)
+		}
+	}
+	if len(tools) == 1 {
+		return tools[0]
+	}
+	debugf("running %s to find its platform", dir)
+	cmd := exec.Command(filepath.Join(dir, "go", "bin", "go"+Exe()), "env", "GOHOSTOS", "GOHOSTARCH")
+	cmd.Env = dedupEnv(caseInsensitiveEnv, append(os.Environ(), "GOROOT="+filepath.Join(dir, "go"), "GOTOOLCHAIN=local"))
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	if f := strings.Fields(string(out)); len(f) == 2 && knownPlatforms[f[0]+"/"+f[1]] {
+		return f[0] + "/" + f[1]
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package gover
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// processAlive reports whether the process pid is running.
+func processAlive(pid int) bool {
+	if runtime.GOOS == "plan9" {
+		_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+		return err == nil
+	}
+	// On Windows, this opens the process, which fails once it is gone.
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
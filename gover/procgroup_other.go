@@ -0,0 +1,9 @@
+//go:build !unix
+
+package gover
+
+import "os/exec"
+
+// killGroupOnCancel leaves cmd as it is: without process groups, cancelling
+// it only kills the make script itself.
+func killGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,167 @@
+package gover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProgressJSON is set by --progress=json. Progress is then reported as
+// progressEvents on stdout, and the output meant for humans, such as that
+// of the build, goes to stderr instead; see humanOut.
+var ProgressJSON bool
+
+// HumanOutput, if set, receives the output meant for humans instead of
+// stdout, such as for commands whose stdout belongs to the toolchain run.
+var HumanOutput io.Writer
+
+// ProgressEvent is a line of the output of --progress=json.
+type ProgressEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Version is the Go version being installed.
+	Version string `json:"version,omitempty"`
+	// URL is the file being downloaded.
+	URL string `json:"url,omitempty"`
+	// Bytes is how much of URL was downloaded, and Total its size, if
+	// known.
+	Bytes int64 `json:"bytes,omitempty"`
+	Total int64 `json:"total,omitempty"`
+	// File is the archive verified.
+	File string `json:"file,omitempty"`
+	// Files counts the files extracted so far.
+	Files int    `json:"files,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+var progressMu sync.Mutex
+
+// EmitProgress prints e as JSON if --progress=json is set.
+func EmitProgress(e ProgressEvent) {
+	if !ProgressJSON {
+		return
+	}
+	e.Time = time.Now()
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	_ = json.NewEncoder(os.Stdout).Encode(e)
+}
+
+// knownSize returns n, or 0 for the -1 standing for an unknown size, so
+// that it is left out of progressEvents.
+func knownSize(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// humanOut returns where to print output meant for humans.
+func humanOut() io.Writer {
+	if ProgressJSON {
+		return os.Stderr
+	}
+	if HumanOutput != nil {
+		return HumanOutput
+	}
+	return os.Stdout
+}
+
+// progressWriter reports the progress of a download as it is written. On a
+// terminal the report is redrawn in place; otherwise a line is printed for
+// every 10% so that logs stay readable.
+type progressWriter struct {
+	w       io.Writer
+	url     string
+	total   int64 // -1 if unknown
+	n       int64
+	start   time.Time
+	last    time.Time
+	lastPct int64
+	tty     bool
+}
+
+func newProgressWriter(w io.Writer, url string, total int64) *progressWriter {
+	now := time.Now()
+	f, ok := w.(*os.File)
+	return &progressWriter{
+		w:     w,
+		url:   url,
+		total: total,
+		start: now,
+		last:  now,
+		tty:   ok && isTerminal(f),
+	}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	if ProgressJSON {
+		if time.Since(p.last) >= 500*time.Millisecond {
+			p.last = time.Now()
+			EmitProgress(ProgressEvent{Event: "download_progress", URL: p.url, Bytes: p.n, Total: knownSize(p.total)})
+		}
+		return len(b), nil
+	}
+	if p.tty {
+		if time.Since(p.last) >= 200*time.Millisecond {
+			p.last = time.Now()
+			fmt.Fprintf(p.w, "\r%-40s", p.status())
+		}
+		return len(b), nil
+	}
+	if p.total > 0 {
+		if pct := p.n * 100 / p.total; pct >= p.lastPct+10 {
+			p.lastPct = pct - pct%10
+			fmt.Fprintln(p.w, p.status())
+		}
+	}
+	return len(b), nil
+}
+
+// done prints the final status line.
+func (p *progressWriter) done() {
+	if ProgressJSON {
+		return
+	}
+	if p.tty {
+		fmt.Fprintf(p.w, "\r%-40s\n", p.status())
+	}
+}
+
+func (p *progressWriter) status() string {
+	rate := ""
+	if d := time.Since(p.start).Seconds(); d > 0 {
+		rate = fmt.Sprintf(" (%s/s)", HumanBytes(int64(float64(p.n)/d)))
+	}
+	if p.total <= 0 {
+		return fmt.Sprintf("%s%s", HumanBytes(p.n), rate)
+	}
+	return fmt.Sprintf("%3d%% of %s%s", p.n*100/p.total, HumanBytes(p.total), rate)
+}
+
+// HumanBytes formats n as a size using binary units.
+func HumanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// isTerminal reports whether f refers to a character device.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,304 @@
+package gover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Release is a release as described by the go.dev/dl JSON feed.
+type Release struct {
+	Version string
+	Stable  bool
+	Files   []File
+}
+
+// File is a single downloadable archive of a Release.
+type File struct {
+	Filename string
+	OS       string
+	Arch     string
+	Version  string
+	SHA256   string
+	Size     int64
+	Kind     string
+}
+
+// releaseCacheTTL is how long a cached copy of the release feed is reused.
+const releaseCacheTTL = 10 * time.Minute
+
+// Offline keeps Releases from fetching the release feed: a copy cached
+// under root is used however old it is, and without one Releases fails.
+var Offline bool
+
+// Releases fetches the release feed from go.dev. If all is false only the
+// currently supported releases are returned, newest first. Responses are
+// cached under root for releaseCacheTTL; an empty root disables the cache.
+func Releases(root string, all bool) ([]Release, error) {
+	u := "https://go.dev/dl/?mode=json"
+	var releases []Release
+	parse := func(b []byte) error {
+		releases = nil
+		return json.Unmarshal(b, &releases)
+	}
+	if all {
+		err := getCached(root, ".releases-all.json", u+"&include=all", "the release feed", feedHint, parse)
+		return releases, err
+	}
+	// The full feed, as cached by "gover list --remote", holds the
+	// supported releases too.
+	if !readCached(root, ".releases.json", "the release feed", parse) && readCached(root, ".releases-all.json", "the release feed", parse) {
+		return supported(releases), nil
+	}
+	err := getCached(root, ".releases.json", u, "the release feed", feedHint, parse)
+	return releases, err
+}
+
+// feedHint tells how to cache the release feed for use when Offline.
+const feedHint = "run 'gover list --remote' to fetch it"
+
+// supported picks from the full release feed the releases the feed of
+// supported releases lists: the latest patch of each of the two newest
+// stable release series.
+func supported(releases []Release) []Release {
+	var picked []Release
+	seen := map[[2]int]bool{}
+	for _, r := range releases {
+		v, ok := parseVersion(r.Version)
+		if !ok || !r.Stable || seen[[2]int{v.major, v.minor}] {
+			continue
+		}
+		seen[[2]int{v.major, v.minor}] = true
+		picked = append(picked, r)
+		if len(picked) == 2 {
+			break
+		}
+	}
+	return picked
+}
+
+// getCached gets u, describing it as what in errors, and passes its contents
+// to parse. A copy is kept in the file cache under root for
+// releaseCacheTTL, and used instead of getting u again as long as parse
+// accepts it; an empty root disables the cache. When Offline only a cached
+// copy is used, and hint tells how to get one.
+func getCached(root, cache, u, what, hint string, parse func([]byte) error) error {
+	if readCached(root, cache, what, parse) {
+		return nil
+	}
+	if Offline {
+		return fmt.Errorf("%s is needed but not cached; %s", what, hint)
+	}
+	debugf("fetching %s %s", what, u)
+	resp, err := HTTPClient.Get(u)
+	if err != nil {
+		return withKind(ErrNetwork, fmt.Errorf("Getting %s failed: %v", what, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return withKind(ErrNetwork, fmt.Errorf("Could not get %s: HTTP %d: %q", what, resp.StatusCode, b))
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return withKind(ErrNetwork, err)
+	}
+	if err := parse(b); err != nil {
+		return err
+	}
+	if root != "" {
+		// The cache is only an optimization; ignore failures to write it.
+		_ = os.WriteFile(filepath.Join(root, cache), b, 0644)
+	}
+	return nil
+}
+
+// readCached passes the copy of what in the file cache under root to
+// parse, and reports whether there was one fresh enough that parse
+// accepted. When Offline, any copy will do.
+func readCached(root, cache, what string, parse func([]byte) error) bool {
+	if root == "" {
+		return false
+	}
+	cache = filepath.Join(root, cache)
+	fi, err := os.Stat(cache)
+	if err != nil || !Offline && time.Since(fi.ModTime()) >= releaseCacheTTL {
+		return false
+	}
+	b, err := os.ReadFile(cache)
+	if err != nil || parse(b) != nil {
+		return false
+	}
+	debugf("using cached %s %s", what, cache)
+	return true
+}
+
+// ReleaseNote is what the Go release history says about a release, which
+// the release feed leaves out.
+type ReleaseNote struct {
+	Date time.Time
+	// Security is set for releases that fix security issues.
+	Security bool
+}
+
+// releaseEntry matches the start of a release's entry in the release
+// history, such as "go1.21.5 (released 2023-12-05)".
+var releaseEntry = regexp.MustCompile(`go(\d+\.\d+(?:\.\d+)?(?:(?:rc|beta)\d+)?)\s+\(released\s+(\d{4}-\d{2}-\d{2})\)`)
+
+// ReleaseNotes returns the notes on each release in the release history
+// published at go.dev/doc/devel/release, by version, such as "1.21.5". It
+// is cached under root like Releases.
+func ReleaseNotes(root string) (map[string]ReleaseNote, error) {
+	var notes map[string]ReleaseNote
+	err := getCached(root, ".release-history.html", "https://go.dev/doc/devel/release", "the release history", "run 'gover info' on any version to fetch it", func(b []byte) error {
+		notes = parseReleaseHistory(string(b))
+		if len(notes) == 0 {
+			return fmt.Errorf("the release history at go.dev lists no releases")
+		}
+		return nil
+	})
+	return notes, err
+}
+
+// parseReleaseHistory extracts the release notes from the HTML of the
+// release history. Each release has a paragraph or heading of its own,
+// which mentions security fixes, if any.
+func parseReleaseHistory(page string) map[string]ReleaseNote {
+	notes := map[string]ReleaseNote{}
+	matches := releaseEntry.FindAllStringSubmatchIndex(page, -1)
+	for i, m := range matches {
+		date, err := time.Parse("2006-01-02", page[m[4]:m[5]])
+		if err != nil {
+			continue
+		}
+		text := page[m[1]:]
+		if i+1 < len(matches) {
+			text = page[m[1]:matches[i+1][0]]
+		}
+		for _, tag := range []string{"</p>", "</h2>", "</h3>"} {
+			if j := strings.Index(text, tag); j >= 0 {
+				text = text[:j]
+			}
+		}
+		notes[page[m[2]:m[3]]] = ReleaseNote{Date: date, Security: strings.Contains(text, "security")}
+	}
+	return notes
+}
+
+// LatestVersion returns the newest stable release, such as "go1.21.3".
+// The feed lists releases newest first, and security fixes ship as ordinary
+// patch releases, so the result is always the most recent patch of the
+// newest major version. Betas and release candidates are never chosen.
+//
+// Copied from https://go.googlesource.com/tools/+/master/cmd/getgo/download.go
+func LatestVersion(root string) (string, error) {
+	releases, err := Releases(root, false)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range releases {
+		if r.Stable {
+			return r.Version, nil
+		}
+	}
+	return "", fmt.Errorf("Could not get at least one Go release")
+}
+
+// UpgradeVersion returns the newest stable release with the same major and
+// minor version as cur, or only the same major version if minor is set. It
+// returns "" if there is nothing newer than cur.
+func UpgradeVersion(root, cur string, minor bool) (string, error) {
+	from, ok := parseVersion(cur)
+	if !ok {
+		return "", fmt.Errorf("cannot upgrade %q: not a Go release version", cur)
+	}
+	releases, err := Releases(root, true)
+	if err != nil {
+		return "", err
+	}
+	best, next := from, ""
+	for _, r := range releases {
+		v, ok := parseVersion(r.Version)
+		if !ok || !r.Stable || v.major != from.major || (!minor && v.minor != from.minor) {
+			continue
+		}
+		if best.less(v) {
+			best, next = v, strings.TrimPrefix(r.Version, "go")
+		}
+	}
+	return next, nil
+}
+
+// LatestPatch returns the newest stable release of the series s, such as
+// 1.21.5 for 1.21, according to the release feed.
+func LatestPatch(root, s string) (string, error) {
+	want, _ := parseVersion(s)
+	releases, err := Releases(root, true)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s without the release feed; give a full version instead: %w", s, err)
+	}
+	var best goVersion
+	found := ""
+	for _, r := range releases {
+		v, ok := parseVersion(r.Version)
+		if !ok || !r.Stable || v.major != want.major || v.minor != want.minor {
+			continue
+		}
+		if found == "" || best.less(v) {
+			best, found = v, strings.TrimPrefix(r.Version, "go")
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("no stable release of Go %s found", s)
+	}
+	return found, nil
+}
+
+// Patches returns every stable release of the series s, such as 1.21.0
+// through 1.21.5 for 1.21, oldest first, according to the release feed.
+func Patches(root, s string) ([]string, error) {
+	want, _ := parseVersion(s)
+	releases, err := Releases(root, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the releases of %s without the release feed: %w", s, err)
+	}
+	var found []string
+	vers := map[string]goVersion{}
+	for _, r := range releases {
+		v, ok := parseVersion(r.Version)
+		if !ok || !r.Stable || v.major != want.major || v.minor != want.minor {
+			continue
+		}
+		name := strings.TrimPrefix(r.Version, "go")
+		if _, dup := vers[name]; !dup {
+			found = append(found, name)
+			vers[name] = v
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no stable release of Go %s found", s)
+	}
+	newestFirst(found, vers)
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found, nil
+}
+
+// releaseFile looks up the archive named filename in releases.
+func releaseFile(releases []Release, filename string) (File, bool) {
+	for _, r := range releases {
+		for _, f := range r.Files {
+			if f.Filename == filename {
+				return f, true
+			}
+		}
+	}
+	return File{}, false
+}
@@ -0,0 +1,185 @@
+package gover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNotInstalled is returned by Check for versions that were
+// never installed.
+var ErrNotInstalled = errors.New("not installed")
+
+// Check checks that the toolchain for version under root is
+// complete enough to run. Its errors tell how to repair a broken toolchain,
+// and wrap ErrNotInstalled if there is none at all.
+func Check(root, version string) error {
+	dir := filepath.Join(root, version)
+	if _, err := os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Go %s is %w", version, ErrNotInstalled)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		tgt, _ := os.Readlink(dir)
+		return fmt.Errorf("%s points at %s, which is gone; run 'gover remove %s' and download it again", dir, tgt, version)
+	}
+	for _, f := range []string{filepath.Join("go", "bin", "go"+Exe()), filepath.Join("go", "src")} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return fmt.Errorf("toolchain at %s is incomplete (no %s); run 'gover remove %s' and download it again", dir, f, version)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the installed toolchain that version refers to under
+// root, taking a series such as 1.21 to mean its newest release installed.
+// Along with it, it returns an error if that toolchain cannot be run on
+// this machine, or, like Check, is not installed or incomplete.
+func Resolve(root, version string) (string, error) {
+	if v := InstalledSeries(root, version); v != "" {
+		version = v
+	}
+	if p, ok := StagedPlatform(version); ok {
+		return version, fmt.Errorf("%s is a toolchain for %s and cannot be run on this machine", version, p)
+	}
+	return version, Check(root, version)
+}
+
+// Command returns the exec.Cmd to run the go command of version under root
+// with the given arguments, in the environment given by Env. The command is
+// stopped once ctx is done; see Run.
+func Command(ctx context.Context, root, version string, args ...string) (*exec.Cmd, error) {
+	env, err := Env(root, version)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, filepath.Join(root, version, "go", "bin", "go"+Exe()), args...)
+	cmd.Env = env
+	return cmd, nil
+}
+
+// Env returns the environment to run commands using version in:
+// the inherited one, with GOVER_GO_ENV and then the GOROOT and PATH of
+// version applied.
+func Env(root, version string) ([]string, error) {
+	gorootPath, newPath := Paths(root, version)
+	extra, err := ExtraEnv()
+	if err != nil {
+		return nil, err
+	}
+	env := append(os.Environ(), extra...)
+	return dedupEnv(caseInsensitiveEnv, append(env, "GOROOT="+gorootPath, PathVar()+"="+newPath)), nil
+}
+
+// Paths returns the GOROOT and PATH that version is run with. PATH is the
+// toolchain's bin directory followed by the current PATH, minus any other
+// toolchains under root.
+func Paths(root, version string) (string, string) {
+	gr := filepath.Join(root, version, "go")
+	newPath := filepath.Join(gr, "bin")
+	origPath := filepath.SplitList(os.Getenv(PathVar()))
+	origPath = slices.DeleteFunc(origPath, func(s string) bool {
+		return s == "" || strings.Contains(s, root)
+	})
+	if len(origPath) > 0 {
+		newPath += string(filepath.ListSeparator) + strings.Join(origPath, string(filepath.ListSeparator))
+	}
+	return gr, newPath
+}
+
+// ExtraEnv returns the variables set in GOVER_GO_ENV, one KEY=VALUE pair
+// per line, for gover to add to the environment of the go command only.
+// They take precedence over the inherited environment, but not over the
+// GOROOT and PATH gover sets itself. Of variables set more than once, only
+// the last value is kept.
+func ExtraEnv() ([]string, error) {
+	var env []string
+	for _, line := range strings.Split(os.Getenv("GOVER_GO_ENV"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if k, _, ok := strings.Cut(line, "="); !ok || k == "" {
+			return nil, fmt.Errorf("GOVER_GO_ENV: expected KEY=VALUE, got %q", line)
+		}
+		env = append(env, line)
+	}
+	return dedupEnv(caseInsensitiveEnv, env), nil
+}
+
+// cancelDelay is how long a canceled command gets to exit before it is
+// killed.
+const cancelDelay = 10 * time.Second
+
+// Run starts cmd and waits for it to finish, relaying
+// interrupts and termination requests to it in the meantime so that it gets
+// the chance to clean up rather than being orphaned. Interrupts typed at
+// the terminal reach cmd directly, so those are not relayed again. If cmd
+// was created with a context, canceling that interrupts cmd in the same
+// way, and kills it if it has not exited within 10 seconds.
+func Run(cmd *exec.Cmd) error {
+	if cmd.Cancel != nil {
+		cmd.Cancel = func() error {
+			if runtime.GOOS == "windows" {
+				return cmd.Process.Kill()
+			}
+			return cmd.Process.Signal(os.Interrupt)
+		}
+		if cmd.WaitDelay == 0 {
+			cmd.WaitDelay = cancelDelay
+		}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, ForwardedSignals...)
+	defer signal.Stop(sigs)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// signal.Stop does not close sigs, so end the relay once cmd has
+	// exited, rather than leave it running for good.
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				// On Windows the console already delivers Ctrl-C to
+				// the child, and interrupts can't be sent to other
+				// processes; just keep gover alive until the child
+				// exits.
+				if runtime.GOOS == "windows" || fromTerminal(cmd, sig) {
+					continue
+				}
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	return err
+}
+
+// fromTerminal reports whether sig is an interrupt that reached cmd as
+// well as gover: the interrupt key of a terminal signals the whole
+// foreground process group, so if gover has a controlling terminal and cmd
+// shares gover's process group, cmd most likely got sig from it already.
+func fromTerminal(cmd *exec.Cmd, sig os.Signal) bool {
+	if sig != os.Interrupt || cmd.SysProcAttr != nil {
+		return false
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	tty.Close()
+	return true
+}
@@ -0,0 +1,51 @@
+package gover
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCommandRootWithSpaces(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("the fake toolchain is a shell script")
+	}
+	root := filepath.Join(t.TempDir(), "my go's $HOME (1)")
+	gr := filepath.Join(root, "9.9.9", "go")
+	for _, dir := range []string{filepath.Join(gr, "bin"), filepath.Join(gr, "src")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := "#!/bin/sh\nprintf '%s\\n' \"$GOROOT\" \"$PATH\" \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(gr, "bin", "go"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(root, "9.9.9"); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := Command(context.Background(), root, "9.9.9", "a b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("the toolchain printed %q, want 4 lines", out)
+	}
+	if lines[0] != gr {
+		t.Errorf("GOROOT = %q, want %q", lines[0], gr)
+	}
+	if bin := filepath.SplitList(lines[1])[0]; bin != filepath.Join(gr, "bin") {
+		t.Errorf("PATH starts with %q, want %q", bin, filepath.Join(gr, "bin"))
+	}
+	if lines[2] != "a b" || lines[3] != "" {
+		t.Errorf("arguments = %q, want %q", lines[2:], []string{"a b", ""})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !plan9
+
+package gover
+
+import (
+	"os"
+	"syscall"
+)
+
+// ForwardedSignals are relayed from gover to the go command it runs.
+var ForwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// ExitStatus returns the exit status a shell would report for a process
+// that ended in state: its own, or 128 plus the number of the signal that
+// killed it.
+func ExitStatus(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return state.ExitCode()
+}
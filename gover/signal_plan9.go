@@ -0,0 +1,13 @@
+package gover
+
+import "os"
+
+// ForwardedSignals are relayed from gover to the go command it runs.
+var ForwardedSignals = []os.Signal{os.Interrupt}
+
+// ExitStatus returns the exit status a shell would report for a process
+// that ended in state. Plan 9 processes end with a message rather than a
+// number, so this is 0 for success and 1 otherwise.
+func ExitStatus(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -0,0 +1,473 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// this was copied from golang.org/x/build/internal/untar
+package gover
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TODO(bradfitz): this was copied from x/build/cmd/buildlet/buildlet.go
+// but there were some buildlet-specific bits in there, so the code is
+// forked for now.  Unfork and add some opts arguments here, so the
+// buildlet can use this code somehow.
+
+// Untar reads the tar file from r, which may be compressed with gzip,
+// bzip2 or xz, and writes it into dir.
+func Untar(r io.Reader, dir string) error {
+	return untar(r, dir, "", nil)
+}
+
+// UntarGo is like Untar, but requires every entry to be inside a top-level
+// "go" directory, as it is in Go release archives.
+func UntarGo(r io.Reader, dir string) error {
+	return untarGo(r, dir, nil)
+}
+
+// untarGo is UntarGo, leaving out the entries for which skip, if not nil,
+// returns true.
+func untarGo(r io.Reader, dir string, skip func(name string) bool) error {
+	if err := untar(r, dir, "go", skip); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "go")); err != nil || !fi.IsDir() {
+		return fmt.Errorf("archive did not contain a top-level go directory")
+	}
+	return nil
+}
+
+// untar extracts r into dir. If top is not empty, entries outside the
+// top-level directory top are rejected. Entries for which skip returns true
+// are left out.
+func untar(r io.Reader, dir, top string, skip func(name string) bool) (err error) {
+	t0 := time.Now()
+	nFiles, nSkipped := 0, 0
+	madeDir := map[string]bool{}
+	defer func() {
+		td := time.Since(t0)
+		if err == nil {
+			log.Printf("extracted tarball into %s: %d files, %d dirs (%v)", dir, nFiles, len(madeDir), td)
+			if nSkipped > 0 {
+				log.Printf("left out %d entries", nSkipped)
+			}
+			EmitProgress(ProgressEvent{Event: "extract_done", Files: nFiles})
+		} else {
+			log.Printf("error extracting tarball into %s after %d files, %d dirs, %v: %v", dir, nFiles, len(madeDir), td, err)
+		}
+	}()
+	EmitProgress(ProgressEvent{Event: "extract_started"})
+	lastProgress := t0
+	zr, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	if c, ok := zr.(io.Closer); ok {
+		defer c.Close()
+	}
+	tr := tar.NewReader(zr)
+	limit := expansionLimit(r)
+	var total int64
+	loggedChtimesError := false
+	var dirModes []dirMode
+	symlinks := map[string]string{}
+	for {
+		f, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("tar reading error: %v", err)
+			return fmt.Errorf("tar error: %v", err)
+		}
+		if !validRelPath(f.Name) {
+			return fmt.Errorf("tar contained invalid name error %q", f.Name)
+		}
+		if top != "" && strings.SplitN(path.Clean(f.Name), "/", 2)[0] != top {
+			return fmt.Errorf("tar entry %q is outside the expected %s/ directory", f.Name, top)
+		}
+		if skip != nil && skip(path.Clean(f.Name)) {
+			nSkipped++
+			continue
+		}
+		rel := filepath.FromSlash(f.Name)
+		abs := filepath.Join(dir, rel)
+		if !withinDir(dir, abs) {
+			return fmt.Errorf("tar entry %q escapes the destination directory", f.Name)
+		}
+		// Entries inside an extracted symlink would be written
+		// wherever it points.
+		if l := symlinkAbove(dir, abs, symlinks); l != "" {
+			return fmt.Errorf("tar entry %q is inside symlink %s", f.Name, l)
+		}
+		// Nor may an entry be written through a symlink extracted
+		// under its own name; replace the link instead.
+		if _, ok := symlinks[abs]; ok {
+			if err := os.Remove(abs); err != nil {
+				return err
+			}
+			delete(symlinks, abs)
+		}
+
+		fi := f.FileInfo()
+		mode := fi.Mode()
+		if perm := safePerm(mode); perm != mode.Perm() {
+			debugf("tar entry %s has mode %v; using %v", f.Name, mode.Perm(), perm)
+			mode = mode&^fs.ModePerm | perm
+		}
+		switch {
+		case f.Typeflag == tar.TypeSymlink:
+			// The link is resolved relative to its directory, through
+			// the links extracted before it, and must not lead out of
+			// dir.
+			if filepath.IsAbs(f.Linkname) || path.IsAbs(f.Linkname) ||
+				resolveLink(dir, abs, f.Linkname, symlinks) == "" {
+				return fmt.Errorf("tar symlink %q -> %q escapes the destination directory", f.Name, f.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return err
+			}
+			_ = os.Remove(abs)
+			if err := os.Symlink(filepath.FromSlash(f.Linkname), abs); err != nil {
+				return err
+			}
+			symlinks[abs] = filepath.FromSlash(f.Linkname)
+			nFiles++
+		case f.Typeflag == tar.TypeLink:
+			// The link names another entry of the archive.
+			if !validRelPath(f.Linkname) {
+				return fmt.Errorf("tar hard link %q -> %q has an invalid target", f.Name, f.Linkname)
+			}
+			target := filepath.Join(dir, filepath.FromSlash(f.Linkname))
+			if !withinDir(dir, target) || symlinkAbove(dir, target, symlinks) != "" {
+				return fmt.Errorf("tar hard link %q -> %q escapes the destination directory", f.Name, f.Linkname)
+			}
+			// A hard link to a symlink is another symlink, which
+			// would escape the checks above.
+			if fi, err := os.Lstat(target); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+				return fmt.Errorf("tar hard link %q -> %q links to a symlink", f.Name, f.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return err
+			}
+			_ = os.Remove(abs)
+			if err := os.Link(target, abs); err != nil {
+				return err
+			}
+			nFiles++
+		case mode.IsRegular():
+			// Entries are streamed to disk, so only the disk can fill
+			// up; stop archives that would expand to absurd sizes.
+			if total += f.Size; limit > 0 && total > limit {
+				return fmt.Errorf("archive expands to more than %s; refusing to extract what looks like a decompression bomb", HumanBytes(limit))
+			}
+			// Make the directory. This is redundant because it should
+			// already be made by a directory entry in the tar
+			// beforehand. Thus, don't check for errors; the next
+			// write will fail with the same error.
+			dir := filepath.Dir(abs)
+			if !madeDir[dir] {
+				if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+					return err
+				}
+				madeDir[dir] = true
+			}
+			wf, err := os.OpenFile(abs, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode.Perm())
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(wf, tr)
+			if closeErr := wf.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("error writing to %s: %v", abs, err)
+			}
+			if n != f.Size {
+				return fmt.Errorf("only wrote %d bytes to %s; expected %d", n, abs, f.Size)
+			}
+			// OpenFile only applies the mode to new files, and
+			// then subject to the umask; make sure executables
+			// such as make.bash stay executable.
+			if err := os.Chmod(abs, mode.Perm()); err != nil {
+				return err
+			}
+			modTime := f.ModTime
+			if modTime.After(t0) {
+				// Clamp modtimes at system time. See
+				// golang.org/issue/19062 when clock on
+				// buildlet was behind the gitmirror server
+				// doing the git-archive.
+				modTime = t0
+			}
+			if !modTime.IsZero() {
+				if err := os.Chtimes(abs, modTime, modTime); err != nil && !loggedChtimesError {
+					// benign error. Gerrit doesn't even set the
+					// modtime in these, and we don't end up relying
+					// on it anywhere (the gomote push command relies
+					// on digests only), so this is a little pointless
+					// for now.
+					log.Printf("error changing modtime: %v (further Chtimes errors suppressed)", err)
+					loggedChtimesError = true // once is enough
+				}
+			}
+			nFiles++
+		case mode.IsDir():
+			if err := os.MkdirAll(abs, 0755); err != nil {
+				return err
+			}
+			madeDir[abs] = true
+			modTime := f.ModTime
+			if modTime.After(t0) {
+				modTime = t0
+			}
+			dirModes = append(dirModes, dirMode{abs, mode.Perm(), modTime})
+		default:
+			return fmt.Errorf("tar file entry %s contained unsupported file type %v", f.Name, mode)
+		}
+		if ProgressJSON && time.Since(lastProgress) >= 500*time.Millisecond {
+			lastProgress = time.Now()
+			EmitProgress(ProgressEvent{Event: "extract_progress", Files: nFiles})
+		}
+	}
+	// A symlink checked when it was extracted may lead elsewhere once
+	// the links it goes through are replaced, so check them all again.
+	for abs, target := range symlinks {
+		if resolveLink(dir, abs, target, symlinks) == "" {
+			rel, _ := filepath.Rel(dir, abs)
+			return fmt.Errorf("tar symlink %q -> %q escapes the destination directory", filepath.ToSlash(rel), filepath.ToSlash(target))
+		}
+	}
+	// Directories stay writable until everything is extracted, and
+	// extracting into them changes their modtime; only now apply their
+	// modes and modtimes from the archive, innermost first.
+	for i := len(dirModes) - 1; i >= 0; i-- {
+		d := dirModes[i]
+		if fi, err := os.Lstat(d.path); err != nil || !fi.IsDir() {
+			// A later entry replaced the directory.
+			continue
+		}
+		if !d.modTime.IsZero() {
+			if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil && !loggedChtimesError {
+				log.Printf("error changing modtime: %v (further Chtimes errors suppressed)", err)
+				loggedChtimesError = true
+			}
+		}
+		if err := os.Chmod(d.path, d.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safePerm returns the permissions to extract an entry of the given mode
+// with: those of the archive, except that nobody but the owner may write
+// to the toolchain.
+func safePerm(mode fs.FileMode) fs.FileMode {
+	return mode.Perm() &^ 0022
+}
+
+// maxExpansion bounds how many times larger than the archive its contents
+// may be, to stop decompression bombs. Go releases expand about fivefold.
+const maxExpansion = 20
+
+// expansionLimit returns the most bytes the archive r may extract to, or 0
+// for no limit if its size is unknown. Small archives may always extract to
+// 64 MiB.
+func expansionLimit(r io.Reader) int64 {
+	f, ok := r.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return 0
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0
+	}
+	if limit := fi.Size() * maxExpansion; limit > 64<<20 {
+		return limit
+	}
+	return 64 << 20
+}
+
+// symlinkAbove returns the first of the symlinks that is a parent
+// directory of p, up to dir, or "" if there is none.
+func symlinkAbove(dir, p string, symlinks map[string]string) string {
+	for p = filepath.Dir(p); p != dir && withinDir(dir, p); p = filepath.Dir(p) {
+		if _, ok := symlinks[p]; ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// resolveLink returns the path the symlink at link to target leads to,
+// following the symlinks extracted so far, or "" if it leads out of dir
+// on the way. Comparing the joined paths alone is not enough: in a/b/..,
+// the .. leaves wherever a/b points, not a.
+func resolveLink(dir, link, target string, symlinks map[string]string) string {
+	return resolveIn(dir, filepath.Dir(link), filepath.FromSlash(target), symlinks, 0)
+}
+
+// resolveIn resolves rel relative to the directory cur for resolveLink.
+func resolveIn(dir, cur, rel string, symlinks map[string]string, depth int) string {
+	if depth > 40 {
+		// A loop of links.
+		return ""
+	}
+	for _, c := range strings.Split(rel, string(filepath.Separator)) {
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, c)
+			if t, ok := symlinks[cur]; ok {
+				if cur = resolveIn(dir, filepath.Dir(cur), t, symlinks, depth+1); cur == "" {
+					return ""
+				}
+			}
+		}
+		if !withinDir(dir, cur) {
+			return ""
+		}
+	}
+	return cur
+}
+
+// dirMode records the permissions and modtime of a directory in an
+// archive.
+type dirMode struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// decompress returns a reader for the tar stream in r, picking the
+// decompressor from the stream's magic bytes rather than trusting a file
+// name.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 512)
+	magic, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("\x1f\x8b")):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("bad gzip stream: %v", err)
+		}
+		return zr, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, []byte("\xfd7zXZ\x00")):
+		return xzReader(br)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return nil, fmt.Errorf("zip archives are not supported; use the .tar.gz release instead")
+	case len(magic) >= 262 && bytes.Equal(magic[257:262], []byte("ustar")):
+		return br, nil
+	}
+	return nil, fmt.Errorf("unrecognized archive format; expected a tar file compressed with gzip, bzip2, xz or nothing")
+}
+
+// xzReader decompresses r with the xz command, as the standard library has
+// no xz decompressor.
+func xzReader(r io.Reader) (io.Reader, error) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		return nil, fmt.Errorf("xz-compressed archives need the xz command, which was not found; install it, or decompress the archive with xz -d first")
+	}
+	cmd := exec.Command("xz", "-dc")
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdReader{ReadCloser: out, cmd: cmd, stderr: &stderr}, nil
+}
+
+// cmdReader reads the output of cmd, and reports it failing at the end.
+type cmdReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	err    error
+	done   bool
+}
+
+func (r *cmdReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		if r.wait(); r.err != nil {
+			return n, r.err
+		}
+	}
+	return n, err
+}
+
+// Close stops the command if it has not finished yet.
+func (r *cmdReader) Close() error {
+	if !r.done {
+		_ = r.cmd.Process.Kill()
+		r.ReadCloser.Close()
+		r.wait()
+	}
+	return nil
+}
+
+func (r *cmdReader) wait() {
+	if r.done {
+		return
+	}
+	r.done = true
+	if err := r.cmd.Wait(); err != nil {
+		r.err = fmt.Errorf("bad xz stream: %v: %s", err, bytes.TrimSpace(r.stderr.Bytes()))
+	}
+}
+
+func validRelativeDir(dir string) bool {
+	if strings.Contains(dir, `\`) || path.IsAbs(dir) {
+		return false
+	}
+	dir = path.Clean(dir)
+	if strings.HasPrefix(dir, "../") || strings.HasSuffix(dir, "/..") || dir == ".." {
+		return false
+	}
+	return true
+}
+
+func validRelPath(p string) bool {
+	if p == "" || strings.Contains(p, `\`) || strings.HasPrefix(p, "/") || strings.Contains(p, "../") {
+		return false
+	}
+	return true
+}
+
+// withinDir reports whether the cleaned path p is dir or inside it.
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,309 @@
+package gover
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entry is a tar entry for tarball to write.
+type entry struct {
+	name string
+	typ  byte
+	mode int64
+	body string
+	link string
+	mod  time.Time
+}
+
+// tarball returns a gzip-compressed tar archive of entries.
+func tarball(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Typeflag: e.typ, Mode: e.mode, Linkname: e.link, ModTime: e.mod}
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		if h.Mode == 0 {
+			h.Mode = 0644
+			if h.Typeflag == tar.TypeDir {
+				h.Mode = 0755
+			}
+		}
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, e.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUntarModes(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("no Unix permissions on " + runtime.GOOS)
+	}
+	tests := []struct {
+		name string
+		mode int64
+		want os.FileMode
+	}{
+		{"go/src/make.bash", 0755, 0755},
+		{"go/bin/go", 0755, 0755},
+		{"go/bin/gofmt", 0777, 0755},
+		{"go/README.md", 0644, 0644},
+		{"go/LICENSE", 0666, 0644},
+		{"go/private", 0600, 0600},
+	}
+	var entries []entry
+	for _, tt := range tests {
+		entries = append(entries, entry{name: tt.name, mode: tt.mode, body: "x"})
+	}
+	dir := t.TempDir()
+	if err := UntarGo(bytes.NewReader(tarball(t, entries...)), dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		fi, err := os.Stat(filepath.Join(dir, tt.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != tt.want {
+			t.Errorf("%s: mode %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUntarModTime(t *testing.T) {
+	old := time.Date(2023, 8, 8, 15, 4, 0, 0, time.UTC)
+	future := time.Now().Add(24 * time.Hour)
+	dir := t.TempDir()
+	err := UntarGo(bytes.NewReader(tarball(t,
+		entry{name: "go/", typ: tar.TypeDir, mod: old},
+		entry{name: "go/old", body: "x", mod: old},
+		entry{name: "go/future", body: "x", mod: future},
+	)), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"go", "go/old"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(old) {
+			t.Errorf("%s: modtime %v, want %v", name, fi.ModTime(), old)
+		}
+	}
+	fi, err := os.Stat(filepath.Join(dir, "go/future"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.ModTime().After(time.Now()) {
+		t.Errorf("go/future: modtime %v is in the future", fi.ModTime())
+	}
+}
+
+func TestUntarRejects(t *testing.T) {
+	tests := []struct {
+		desc    string
+		entries []entry
+		want    string
+	}{
+		{"outside go", []entry{{name: "other/file", body: "x"}}, "outside the expected go/"},
+		{"dot dot", []entry{{name: "go/../../victim", body: "x"}}, "invalid name"},
+		{"absolute", []entry{{name: "/go/victim", body: "x"}}, "invalid name"},
+		{"absolute symlink", []entry{{name: "go/l", typ: tar.TypeSymlink, link: "/etc"}}, "escapes"},
+		{"symlink out", []entry{{name: "go/l", typ: tar.TypeSymlink, link: "../.."}}, "escapes"},
+		{"symlink chain", []entry{
+			{name: "go/a", typ: tar.TypeSymlink, link: "."},
+			{name: "go/b", typ: tar.TypeSymlink, link: "a/../../victim"},
+		}, "escapes"},
+		{"symlink retargeted", []entry{
+			{name: "go/b", typ: tar.TypeSymlink, link: "a/../../x"},
+			{name: "go/a", typ: tar.TypeSymlink, link: "."},
+		}, "escapes"},
+		{"hard link to symlink", []entry{
+			{name: "go/a/b/l", typ: tar.TypeSymlink, link: "../.."},
+			{name: "go/l2", typ: tar.TypeLink, link: "go/a/b/l"},
+			{name: "go/l2/pwned", body: "pwned"},
+		}, "links to a symlink"},
+		{"inside symlink", []entry{
+			{name: "go/l", typ: tar.TypeSymlink, link: "src"},
+			{name: "go/l/file", body: "x"},
+		}, "inside symlink"},
+		{"hard link out", []entry{{name: "go/h", typ: tar.TypeLink, link: "../victim"}}, "invalid target"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		err := UntarGo(bytes.NewReader(tarball(t, tt.entries...)), dir)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.desc, err, tt.want)
+		}
+	}
+}
+
+func TestUntarOverSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("no symlinks on " + runtime.GOOS)
+	}
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(outside, "stage")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := UntarGo(bytes.NewReader(tarball(t,
+		entry{name: "go/bin", typ: tar.TypeSymlink, link: "src"},
+		entry{name: "go/src/", typ: tar.TypeDir},
+		entry{name: "go/bin", body: "file"},
+		entry{name: "go/lib", typ: tar.TypeSymlink, link: "src"},
+		entry{name: "go/lib/", typ: tar.TypeDir, mode: 0700},
+	)), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"go/bin", "go/lib"} {
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("%s is still a symlink", name)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "go/src")); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("go/src changed through a symlink: %v, %v", fi.Mode(), err)
+	}
+	if b, err := os.ReadFile(victim); err != nil || string(b) != "keep" {
+		t.Errorf("file outside the stage changed: %q, %v", b, err)
+	}
+}
+
+func TestUntarSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("no symlinks on " + runtime.GOOS)
+	}
+	dir := t.TempDir()
+	err := UntarGo(bytes.NewReader(tarball(t,
+		entry{name: "go/src/file", body: "hello"},
+		entry{name: "go/a", typ: tar.TypeSymlink, link: "src"},
+		entry{name: "go/b", typ: tar.TypeSymlink, link: "a/file"},
+	)), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "go/b"))
+	if err != nil || string(b) != "hello" {
+		t.Errorf("reading through go/b: %q, %v", b, err)
+	}
+}
+
+func TestUntarSizeLimit(t *testing.T) {
+	// The limit applies to archives on disk, whose size is known.
+	f, err := os.Create(filepath.Join(t.TempDir(), "bomb.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, err := gzip.NewWriterLevel(f, gzip.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	const size = 65 << 20
+	if err := tw.WriteHeader(&tar.Header{Name: "go/zeros", Mode: 0644, Size: size}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(tw, zeros{}, size); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	err = UntarGo(f, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "decompression bomb") {
+		t.Errorf("got error %v, want a decompression bomb", err)
+	}
+}
+
+func TestUntarMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("extracts a large archive")
+	}
+	// An archive whose size is unknown, so that no limit applies.
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	const size = 256 << 20
+	if err := tw.WriteHeader(&tar.Header{Name: "go/zeros", Mode: 0644, Size: size}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(tw, zeros{}, size); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := UntarGo(bytes.NewReader(buf.Bytes()), dir); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	// Entries are streamed to disk, so what is allocated on the way does
+	// not grow with their size.
+	if n := after.TotalAlloc - before.TotalAlloc; n > 16<<20 {
+		t.Errorf("extracting %s allocated %s", HumanBytes(size), HumanBytes(int64(n)))
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "go/zeros")); err != nil || fi.Size() != size {
+		t.Errorf("go/zeros: %v, %v", fi, err)
+	}
+}
+
+// zeros reads as an endless run of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
@@ -0,0 +1,383 @@
+package gover
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Google Inc. (Linux Packages Signing Authority) <linux-packages-keymaster@google.com>
+// RSA key 0x78BD65473CB3BD13
+// Primary key fingerprint: EB4C 1BFD 4F04 2F6D DDCC  EC91 7721 F63B D38B 4796
+// Subkey fingerprint:      2F52 8D36 D67B 69ED F998  D857 78BD 6547 3CB3 BD13
+//
+// Download key: https://www.google.com/linuxrepositories/
+// Direct link: https://dl.google.com/linux/linux_signing_key.pub
+// Import into gpg:
+//
+//	gpg --import google.pub
+//	gpg --import linux_signing_key.pub
+//	gpg --export --armor linux-packages-keymaster@google.com > google.pub
+//
+// ^ this is needed because they seem to publish a partial key..
+//
+// Every *.pub file is embedded, so that archives signed before a key
+// rotation still verify once the new key is added next to the old one.
+//
+//go:embed *.pub
+var pubKeys embed.FS
+
+// signingKeyFingerprint is the fingerprint of the primary key above. Keys
+// fetched by UpdateKeys are only ever trusted if they have it.
+const signingKeyFingerprint = "EB4C1BFD4F042F6DDDCCEC917721F63BD38B4796"
+
+// signingKeyURL is where Google publishes the current signing key.
+const signingKeyURL = "https://dl.google.com/linux/linux_signing_key.pub"
+
+// updatedKeysFile is the file under root holding the key stored by
+// UpdateKeys.
+const updatedKeysFile = ".signing-keys.pub"
+
+// keyRing returns the embedded signing keys, followed by the one stored
+// under root by UpdateKeys, if any.
+func keyRing(root string) (openpgp.EntityList, error) {
+	names, err := fs.Glob(pubKeys, "*.pub")
+	if err != nil {
+		return nil, err
+	}
+	var kr openpgp.EntityList
+	for _, name := range names {
+		f, err := pubKeys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := openpgp.ReadArmoredKeyRing(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading embedded key %s: %v", name, err)
+		}
+		kr = append(kr, keys...)
+	}
+	if root == "" {
+		return kr, nil
+	}
+	file := filepath.Join(root, updatedKeysFile)
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return kr, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v; run 'gover update-keys' again, or remove it", file, err)
+	}
+	pinned := pinnedKeys(keys)
+	if len(pinned) == 0 {
+		return nil, fmt.Errorf("%s holds no key with fingerprint %s; run 'gover update-keys' again, or remove it", file, signingKeyFingerprint)
+	}
+	debugf("using signing keys from %s", file)
+	return append(kr, pinned...), nil
+}
+
+// CheckEmbeddedKeys checks that the signing keys built into gover parse and
+// include the pinned key. If they do not, gover itself was built wrong, and
+// no archive can be verified.
+func CheckEmbeddedKeys() error {
+	kr, err := keyRing("")
+	if err != nil {
+		return fmt.Errorf("this build of gover is broken, %v; reinstall gover", err)
+	}
+	if len(pinnedKeys(kr)) == 0 {
+		return fmt.Errorf("this build of gover is broken: no embedded key has the fingerprint %s; reinstall gover", signingKeyFingerprint)
+	}
+	return nil
+}
+
+// pinnedKeys returns the keys in kr with the pinned signingKeyFingerprint.
+func pinnedKeys(kr openpgp.EntityList) openpgp.EntityList {
+	var pinned openpgp.EntityList
+	for _, e := range kr {
+		if fmt.Sprintf("%X", e.PrimaryKey.Fingerprint) == signingKeyFingerprint {
+			pinned = append(pinned, e)
+		}
+	}
+	return pinned
+}
+
+// UpdateKeys fetches the current signing key from Google and, if it has the
+// fingerprint gover pins, stores it under root, to verify archives with
+// alongside the embedded keys. This lets gover verify archives signed with
+// subkeys added after it was built. It returns the path of the stored key.
+func UpdateKeys(root string) (string, error) {
+	debugf("fetching signing key %s", signingKeyURL)
+	resp, err := HTTPClient.Get(signingKeyURL)
+	if err != nil {
+		return "", withKind(ErrNetwork, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", withKind(ErrNetwork, fmt.Errorf("fetching %s: %s", signingKeyURL, resp.Status))
+	}
+	keys, err := openpgp.ReadArmoredKeyRing(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %v", signingKeyURL, err)
+	}
+	pinned := pinnedKeys(keys)
+	if len(pinned) == 0 {
+		return "", fmt.Errorf("%s holds no key with fingerprint %s; not trusting it", signingKeyURL, signingKeyFingerprint)
+	}
+
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range pinned {
+		if err := e.Serialize(w); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	file := filepath.Join(root, updatedKeysFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return file, nil
+}
+
+// verifyArchive checks tbz, whose SHA256 is tbzSum, against the expected
+// sum (if set) and the detached signature sig. On success tbz is rewound.
+func verifyArchive(kr openpgp.KeyRing, tbz *os.File, tbzSum string, sig io.Reader, sum string, name string) error {
+	if sum == "" {
+		log.Printf("no published SHA256 for %s; relying on the signature alone", name)
+	} else if !strings.EqualFold(sum, tbzSum) {
+		return withKind(ErrVerification, fmt.Errorf("SHA256 mismatch for %s: expected %s, got %s", name, sum, tbzSum))
+	}
+
+	// Keep the signature to tell when it was made, below.
+	armored, err := io.ReadAll(io.LimitReader(sig, 1<<20))
+	if err != nil {
+		return err
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(kr, tbz, bytes.NewReader(armored))
+	if err != nil {
+		return withKind(ErrVerification, err)
+	}
+	debugf("%s is signed by key %X", name, signer.PrimaryKey.Fingerprint)
+
+	by := "signed by " + identityName(signer)
+	if t := signatureTime(armored); !t.IsZero() {
+		by += " on " + t.UTC().Format("2006-01-02 15:04 MST")
+	}
+	fmt.Fprintf(humanOut(), "Signature OK, %s. SHA256: %s\n", by, tbzSum)
+	EmitProgress(ProgressEvent{Event: "verify_done", File: name})
+
+	_, err = tbz.Seek(0, 0)
+	return err
+}
+
+// identityName returns the name of the primary identity of e, such as
+// "Google Inc. (Linux Packages Signing Authority) <...>", or of its first
+// identity if none is marked primary.
+func identityName(e *openpgp.Entity) string {
+	var name string
+	for n, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return n
+		}
+		if name == "" || n < name {
+			name = n
+		}
+	}
+	if name == "" {
+		return fmt.Sprintf("key %X", e.PrimaryKey.Fingerprint)
+	}
+	return name
+}
+
+// signatureTime returns when the armored signature was made, or the zero
+// time if that cannot be told.
+func signatureTime(armored []byte) time.Time {
+	block, err := armor.Decode(bytes.NewReader(armored))
+	if err != nil {
+		return time.Time{}
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return time.Time{}
+	}
+	switch s := p.(type) {
+	case *packet.Signature:
+		return s.CreationTime
+	case *packet.SignatureV3:
+		return s.CreationTime
+	}
+	return time.Time{}
+}
+
+// openLocal opens the archive at fp for installing and returns it. If a
+// signature is present next to it in fp.asc, the archive is verified against
+// the signing keys; otherwise it is used as is, with a warning. If sum is
+// set, the archive must have that SHA256 either way.
+func openLocal(root, fp, sum string) (*os.File, error) {
+	kr, err := keyRing(root)
+	if err != nil {
+		return nil, err
+	}
+	tbz, tbzSum, err := openExisting(fp)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.Open(fp + ".asc")
+	if errors.Is(err, fs.ErrNotExist) {
+		if sum != "" && !strings.EqualFold(sum, tbzSum) {
+			tbz.Close()
+			return nil, withKind(ErrVerification, fmt.Errorf("SHA256 mismatch for %s: expected %s, got %s", filepath.Base(fp), sum, tbzSum))
+		}
+		log.Printf("WARNING: no signature found at %s.asc; %s is NOT verified", fp, fp)
+		return tbz, nil
+	}
+	if err != nil {
+		tbz.Close()
+		return nil, err
+	}
+	defer sig.Close()
+	if err := verifyArchive(kr, tbz, tbzSum, sig, sum, filepath.Base(fp)); err != nil {
+		tbz.Close()
+		return nil, err
+	}
+	return tbz, nil
+}
+
+// Verify checks that the toolchain installed as name under root is
+// intact: its go binary must be present and executable, and any archives of
+// it left in the cache must still match their signatures.
+func Verify(root, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid version %q", name)
+	}
+	// Check what "latest" and the like point at.
+	if tgt := aliasTarget(root, name); tgt != "" {
+		name = tgt
+	}
+	dir := filepath.Join(root, name)
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("version %s is not installed in %v", name, root)
+	}
+
+	version, goos, goarch := name, runtime.GOOS, runtime.GOARCH
+	if p, ok := StagedPlatform(name); ok {
+		version = name[:strings.LastIndex(name, ".")]
+		goos, goarch, _ = strings.Cut(p, "/")
+	}
+	gobin := filepath.Join(dir, "go", "bin", "go")
+	if goos == "windows" {
+		gobin += ".exe"
+	}
+	fi, err := os.Stat(gobin)
+	if err != nil {
+		return withKind(ErrVerification, fmt.Errorf("Go %s is broken: %v", name, err))
+	}
+	if !fi.Mode().IsRegular() || (runtime.GOOS != "windows" && fi.Mode()&0111 == 0) {
+		return withKind(ErrVerification, fmt.Errorf("Go %s is broken: %s is not an executable file", name, gobin))
+	}
+	if _, err := os.Stat(filepath.Join(dir, completeMarker)); err != nil {
+		// Older versions of gover did not mark complete installs.
+		log.Printf("WARNING: Go %s may not be completely installed; 'gover download %s' installs it afresh", name, version)
+	}
+
+	kr, err := keyRing(root)
+	if err != nil {
+		return err
+	}
+	checked := false
+	for _, archive := range []string{fmt.Sprintf("go%s.src.tar.gz", version), binaryArchive(version, goos, goarch)} {
+		fp := filepath.Join(CacheDir(root), archive)
+		tbz, tbzSum, err := openExisting(fp)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sig, err := os.Open(fp + ".asc")
+		if err != nil {
+			tbz.Close()
+			return fmt.Errorf("Go %s: cannot check %s: %v", name, fp, err)
+		}
+		err = verifyArchive(kr, tbz, tbzSum, sig, "", archive)
+		sig.Close()
+		tbz.Close()
+		if err != nil {
+			return fmt.Errorf("Go %s: cached %s failed verification: %w", name, archive, err)
+		}
+		checked = true
+	}
+	if !checked {
+		log.Printf("No archive of Go %s is cached; only checked the installed files", name)
+	}
+	log.Printf("Go %s: OK", name)
+	return nil
+}
+
+// CheckKeys checks that the signing keys, embedded or stored under root by
+// UpdateKeys, parse, are not revoked, and can still sign with their primary
+// key or a subkey that has not expired.
+func CheckKeys(root string) (string, error) {
+	kr, err := keyRing(root)
+	if err != nil {
+		return "", err
+	}
+	if len(kr) == 0 {
+		return "", fmt.Errorf("no keys embedded")
+	}
+	now := time.Now()
+	var keys []string
+	for _, e := range kr {
+		current := 0
+		for _, id := range e.Identities {
+			if sig := id.SelfSignature; sig.FlagsValid && sig.FlagSign && !sig.KeyExpired(now) {
+				current++
+			}
+		}
+		for _, sk := range e.Subkeys {
+			if sk.Sig.FlagsValid && sk.Sig.FlagSign && !sk.Sig.KeyExpired(now) {
+				current++
+			}
+		}
+		if len(e.Revocations) > 0 {
+			return "", fmt.Errorf("key %X is revoked", e.PrimaryKey.Fingerprint)
+		}
+		if current == 0 {
+			return "", fmt.Errorf("key %X has expired", e.PrimaryKey.Fingerprint)
+		}
+		if fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint); !slices.Contains(keys, fp) {
+			keys = append(keys, fp)
+		}
+	}
+	return strings.Join(keys, ", "), nil
+}
@@ -0,0 +1,32 @@
+package gover
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckEmbeddedKeys(t *testing.T) {
+	if err := CheckEmbeddedKeys(); err != nil {
+		t.Fatal(err)
+	}
+	kr, err := keyRing(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinnedKeys(kr)) == 0 {
+		t.Errorf("no embedded key has the fingerprint %s", signingKeyFingerprint)
+	}
+}
+
+func TestKeyRingBadUpdate(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, updatedKeysFile), []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := keyRing(root)
+	if err == nil || !strings.Contains(err.Error(), "gover update-keys") {
+		t.Errorf("got error %v, want one suggesting 'gover update-keys'", err)
+	}
+}
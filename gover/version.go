@@ -0,0 +1,153 @@
+package gover
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionRE matches Go release versions such as 1.21, 1.21.3, 1.22rc1 and
+// 1.21beta2.
+var versionRE = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?(?:(beta|rc)(\d+))?$`)
+
+// goVersion is a parsed Go release version.
+type goVersion struct {
+	major, minor, patch int
+	pre                 string // "beta", "rc" or "" for a final release
+	preNum              int
+}
+
+// parseVersion parses a release version, with or without a leading "go".
+func parseVersion(s string) (goVersion, bool) {
+	m := versionRE.FindStringSubmatch(strings.TrimPrefix(s, "go"))
+	if m == nil {
+		return goVersion{}, false
+	}
+	var v goVersion
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	v.patch, _ = strconv.Atoi(m[3])
+	v.pre = m[4]
+	v.preNum, _ = strconv.Atoi(m[5])
+	return v, true
+}
+
+// checkVersion returns an error unless s is a release version as used in
+// archive names, such as 1.21.0 or 1.22rc1, without a leading "go".
+func checkVersion(s string) error {
+	m := versionRE.FindStringSubmatch(s)
+	if m == nil {
+		return fmt.Errorf("invalid version %q: expected a Go release such as 1.21.0 or 1.22rc1", s)
+	}
+	if m[3] == "0" && m[4] != "" {
+		return fmt.Errorf("invalid version %q: prereleases of a new series are named like %s", s, ReleaseVersion(s))
+	}
+	return nil
+}
+
+// ReleaseVersion returns s as Go names the release in its archives: without
+// a leading "go", and without the ".0" patch number that is sometimes added
+// to prereleases, as in 1.22.0rc1 for 1.22rc1. Other strings are returned
+// unchanged.
+func ReleaseVersion(s string) string {
+	m := versionRE.FindStringSubmatch(strings.TrimPrefix(s, "go"))
+	if m == nil {
+		return s
+	}
+	if m[4] != "" && m[3] == "0" {
+		return fmt.Sprintf("%s.%s%s%s", m[1], m[2], m[4], m[5])
+	}
+	return strings.TrimPrefix(s, "go")
+}
+
+// IsSeries reports whether s names a release series, such as 1.21, rather
+// than a single release. Before Go 1.21 the first release of a series was
+// named like the series; see InstalledSeries and LatestPatch for how such
+// versions are resolved.
+func IsSeries(s string) bool {
+	m := versionRE.FindStringSubmatch(s)
+	return m != nil && m[3] == "" && m[4] == ""
+}
+
+// InstalledSeries returns the newest installed release of the series s,
+// such as 1.21.5 for 1.21, or s itself if it is installed under that name
+// or is not a series at all. It returns "" if no release of s is
+// installed.
+func InstalledSeries(root, s string) string {
+	if !IsSeries(s) {
+		return s
+	}
+	if _, err := os.Lstat(filepath.Join(root, s)); err == nil {
+		return s
+	}
+	want, _ := parseVersion(s)
+	entries, _ := os.ReadDir(root)
+	var best goVersion
+	found := ""
+	for _, entry := range entries {
+		v, ok := parseVersion(entry.Name())
+		if !ok || !entry.IsDir() || strings.HasPrefix(entry.Name(), "go") ||
+			v.major != want.major || v.minor != want.minor || v.pre != "" {
+			continue
+		}
+		if found == "" || best.less(v) {
+			best, found = v, entry.Name()
+		}
+	}
+	return found
+}
+
+// less reports whether v is an earlier release than w. Prereleases sort
+// before the final release of the same version.
+func (v goVersion) less(w goVersion) bool {
+	if v.major != w.major {
+		return v.major < w.major
+	}
+	if v.minor != w.minor {
+		return v.minor < w.minor
+	}
+	if v.patch != w.patch {
+		return v.patch < w.patch
+	}
+	if v.pre != w.pre {
+		// "" (final) > "rc" > "beta"
+		return v.pre != "" && (w.pre == "" || v.pre < w.pre)
+	}
+	return v.preNum < w.preNum
+}
+
+func (v goVersion) String() string {
+	s := fmt.Sprintf("%d.%d", v.major, v.minor)
+	if v.patch > 0 || (v.pre == "" && v.major == 1 && v.minor >= 21) {
+		s += fmt.Sprintf(".%d", v.patch)
+	}
+	if v.pre != "" {
+		s += fmt.Sprintf("%s%d", v.pre, v.preNum)
+	}
+	return s
+}
+
+// IsVersionArg reports whether arg, given where a subcommand or version is
+// expected, names a version: either something that looks like a release, or
+// an existing entry under root such as "latest".
+func IsVersionArg(root, arg string) bool {
+	if _, ok := parseVersion(arg); ok || arg == "latest" {
+		return true
+	}
+	if arg == "" || strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, ".") || strings.ContainsAny(arg, `/\`) {
+		return false
+	}
+	// Only directories (or links to them) hold toolchains. Dangling
+	// links count, so that the run path can explain what is wrong.
+	fi, err := os.Lstat(filepath.Join(root, arg))
+	if err != nil {
+		return false
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return true
+	}
+	return fi.IsDir()
+}
@@ -0,0 +1,28 @@
+package gover
+
+import "testing"
+
+func TestVersionLess(t *testing.T) {
+	// Oldest first.
+	order := []string{"1.9", "1.19beta1", "1.19rc1", "1.19rc2", "1.19", "1.19.1", "1.19.10", "go1.20rc1", "1.20", "1.21.0", "2.0"}
+	for i := range order {
+		v, ok := parseVersion(order[i])
+		if !ok {
+			t.Fatalf("parseVersion(%q) failed", order[i])
+		}
+		for j := range order {
+			w, _ := parseVersion(order[j])
+			if got := v.less(w); got != (i < j) {
+				t.Errorf("%s less than %s = %v, want %v", order[i], order[j], got, i < j)
+			}
+		}
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, s := range []string{"", "1", "latest", "1.21.x", "1.21-rc1", "1.21.0.linux-amd64", "v1.21.0"} {
+		if _, ok := parseVersion(s); ok {
+			t.Errorf("parseVersion(%q) succeeded, want failure", s)
+		}
+	}
+}
@@ -11,379 +11,1604 @@
 // And then use the gover command as if it were your normal go command.
 //
 // To download a specific version, run "gover download VERSION".
-// To download the latest version, run "gover download latest".
+// To download the latest version, run "gover download latest". This resolves
+// to the newest stable release on go.dev and points the "latest" alias at it,
+// so "gover latest" runs whichever version was last installed that way.
+// Release candidates and betas are downloaded the same way, as in "gover
+// download 1.22rc1", and are verified like any other release.
+// To pass arguments to the make script, run "gover download --make-args
+// '--no-clean' VERSION".
+// To build with a C compiler other than the system's default, which is also
+// used for cgo, run "gover download --cc clang VERSION" (and --cxx for C++).
+// To install a prebuilt binary release instead of building from source, run
+// "gover download --binary VERSION".
+// To install a toolchain outside the gover root, run "gover download --dest
+// DIR VERSION"; gover links it into its root to find it.
+// To install from an archive on disk, for example without network access, run
+// "gover download --from go1.21.0.src.tar.gz 1.21.0"; a go1.21.0.src.tar.gz.asc
+// next to it is used to verify it.
+// To stage a binary release for another platform, for example to ship it
+// elsewhere, run "gover download --binary --os darwin --arch arm64 VERSION";
+// it is installed as VERSION.darwin-arm64. GOVER_GOOS and GOVER_GOARCH do
+// the same when the flags are not given.
+// To prime the build cache of a fresh install, as for CI images, run
+// "gover download --warm VERSION"; --warm-module DIR also downloads the
+// dependencies of the module in DIR into the module cache.
+// To follow the progress of an install from another program, run "gover
+// download --progress=json VERSION", which prints one JSON event per line.
+// To pin the archive installed, run "gover download --checksum SHA256
+// VERSION"; the download fails unless its SHA256 matches.
+// To only check that a release archive is authentic, run
+// "gover download --verify-only VERSION".
+// To bound how long each phase of an install may take, run "gover download
+// --timeout-download 10m --timeout-build 1h VERSION"; --deadline bounds both
+// together.
+// To save space, as on small machines, run "gover download --no-tests
+// --no-docs VERSION", which leaves out Go's own tests and documentation.
+// To see what a download would do without doing it, run "gover download
+// --dry-run VERSION".
+// To install every patch release of a series, run
+// "gover download --all-patches 1.20".
+// To keep the downloaded archive in the cache after installing, run
+// "gover download --keep-archive VERSION".
+// To see the versions available for download, run "gover list --remote".
+// To see the archives, checksums and install location of a version, run
+// "gover info VERSION".
+// To see what files an installed version has, for example when it seems
+// broken, run "gover list-files VERSION"; add --tree to list them all.
+// To find a release without listing them all, run "gover search TEXT", as in
+// "gover search 1.20".
+// To list installed versions for scripts, run "gover list --json"; add
+// --platform to see the platform each one runs on.
+// To see the GOROOT and PATH a version runs with, run "gover env VERSION".
+// To print the path of a version's go binary, run "gover which VERSION".
+// To run go with a version in scripts, where go's arguments might look like
+// gover commands, run "gover run VERSION -- ARGS...", as in "gover run 1.21.0
+// -- version".
+// To run another command with a version's go first on PATH, run "gover exec
+// VERSION -- COMMAND [ARGS...]".
+// To remove an installed version, run "gover remove VERSION", or "gover
+// prune --keep N" to remove all but the N newest. "gover remove '1.19.*'"
+// or "gover remove 1.19.0..1.20.5" removes every version matching, after
+// asking for confirmation.
+// To check that an installed version is intact, run "gover verify VERSION",
+// and to download and install it again, "gover reinstall VERSION".
+// To print the version of gover itself, run "gover --version"; "gover
+// VERSION version" still runs "go version" with that toolchain.
+// To check that gover can download and build toolchains here, run "gover
+// doctor".
+// To fetch Google's current signing key, should the embedded one be out of
+// date, run "gover update-keys"; it is only used if its fingerprint matches.
+// To see in detail what gover is doing, for example when reporting a bug,
+// add --verbose before the command, as in "gover --verbose download 1.21.0".
+// To pin a project to a version, write the version to a .gover-version file
+// in its root directory; running gover without a version anywhere below it,
+// as in "gover build ./...", then uses that version. Elsewhere, the version
+// in GOVER_DEFAULT, in ~/sdk/gover/default, or else the one selected with
+// "gover use" is used the same way.
+// To load shell completions, follow the instructions printed by
+// "gover completion bash" (or zsh, or fish).
+// To make a version available as plain "go", run "gover use VERSION" and put
+// ~/sdk/gover/current/go/bin on your PATH.
+// To give a version another name, run "gover rename VERSION ALIAS"; "gover
+// ALIAS build" then runs it, and "gover use ALIAS" follows the alias.
+// To update to the newest patch release of the version in use, run "gover
+// upgrade" ("gover upgrade --minor" for the newest minor release); add --use
+// to switch to it as well.
+//
+// Toolchains are kept in ~/sdk/gover unless the --root flag, given before
+// the command, or else GOVER_ROOT names another directory. If XDG_DATA_HOME
+// is set and ~/sdk/gover does not exist yet, $XDG_DATA_HOME/gover is used
+// instead. Downloaded archives are cached in its .cache directory, or in
+// GOVER_CACHE if set, and "gover clean-cache" empties it. "gover clean"
+// removes what failed or interrupted installs left behind. Archives are
+// downloaded from GOVER_DL_URL if set, which allows using an internal mirror
+// of https://dl.google.com/go, with fallbacks in the comma-separated
+// GOVER_MIRRORS. Network operations that make no progress for 30 seconds, or
+// GOVER_HTTP_TIMEOUT if set, time out. GOVER_TLS_MIN_VERSION raises the
+// oldest TLS version accepted to 1.3, and GOVER_PROXY sends all requests
+// through a proxy regardless of HTTPS_PROXY and friends. Messages on a
+// terminal are colored unless NO_COLOR or GOVER_NO_COLOR is set.
+// When gover itself fails, it exits with status 2 for network failures, 3 for
+// failed verifications, 4 for failed builds, 5 for invalid usage and 1 for
+// anything else. Commands run with a toolchain exit with their own status.
+// To manage toolchains from Go programs, import suah.dev/gover/gover.
 package main
 
 import (
-	"bytes"
-	_ "embed"
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"io/fs"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"os/user"
-	"path"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"golang.org/x/crypto/openpgp"
+	"suah.dev/gover/gover"
 	"suah.dev/protect"
 )
 
-// Google Inc. (Linux Packages Signing Authority) <linux-packages-keymaster@google.com>
-// RSA key 0x78BD65473CB3BD13
-// Primary key fingerprint: EB4C 1BFD 4F04 2F6D DDCC  EC91 7721 F63B D38B 4796
-// Subkey fingerprint:      2F52 8D36 D67B 69ED F998  D857 78BD 6547 3CB3 BD13
-//
-// Download key: https://www.google.com/linuxrepositories/
-// Direct link: https://dl.google.com/linux/linux_signing_key.pub
-// Import into gpg:
-//
-//	gpg --import google.pub
-//	gpg --import linux_signing_key.pub
-//	gpg --export --armor linux-packages-keymaster@google.com > google.pub
-//
-// ^ this is needed because they seem to publish a partial key..
-//
-//go:embed google.pub
-var pubKey string
+// debugf logs a message if --verbose was given.
+func debugf(format string, args ...interface{}) {
+	if gover.Verbose {
+		log.Printf("debug: "+format, args...)
+	}
+}
 
 func main() {
 	log.SetFlags(0)
-	root, err := goroot("gover")
+	log.SetOutput(logOutput(os.Stderr))
+
+	global := flag.NewFlagSet("gover", flag.ContinueOnError)
+	global.BoolVar(&gover.Verbose, "verbose", false, "log what gover is doing in detail")
+	showVersion := global.Bool("version", false, "print the version of gover itself")
+	rootFlag := global.String("root", "", "directory holding the toolchains (overrides GOVER_ROOT)")
+	parseFlags(global, os.Args[1:])
+	// Leave only the subcommand and its arguments for the code below.
+	os.Args = append(os.Args[:1], global.Args()...)
+	if *showVersion {
+		fmt.Println(selfVersion())
+		os.Exit(0)
+	}
+	if t := os.Getenv("GOVER_HTTP_TIMEOUT"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d < 0 {
+			log.Fatalf("gover: invalid GOVER_HTTP_TIMEOUT %q, expected a duration such as 30s", t)
+		}
+		gover.HTTPTimeout = d
+	}
+	switch v := os.Getenv("GOVER_TLS_MIN_VERSION"); v {
+	case "":
+	case "1.2":
+		gover.TLSMinVersion = tls.VersionTLS12
+	case "1.3":
+		gover.TLSMinVersion = tls.VersionTLS13
+	default:
+		log.Fatalf("gover: invalid GOVER_TLS_MIN_VERSION %q, expected 1.2 or 1.3", v)
+	}
+	if p := os.Getenv("GOVER_PROXY"); p != "" {
+		u, err := url.Parse(p)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			log.Fatalf("gover: invalid GOVER_PROXY %q, expected a URL such as http://proxy:3128", p)
+		}
+		gover.Proxy = u
+	}
+	gover.HTTPClient = gover.NewHTTPClient(gover.HTTPTimeout)
+
+	root, err := gover.DefaultRoot()
+	if *rootFlag != "" {
+		root, err = filepath.Abs(*rootFlag)
+	}
 	version := ""
 	if err != nil {
-		log.Fatalf("gover: %v", err)
+		fatal(err)
 	}
 
-	if err := os.MkdirAll(root, 0755); err != nil {
-		log.Fatalf("failed to create gover directory: %v\n", err)
+	// A dry run leaves everything on disk as it is, root included.
+	dryRun := len(os.Args) > 1 && os.Args[1] == "download" && boolFlag(os.Args[2:], "dry-run")
+	if !dryRun {
+		if err := gover.MkdirAll(root); err != nil {
+			log.Fatalf("gover: failed to create gover directory: %v", err)
+		}
+	}
+	debugf("using root %s", root)
+	if strings.ContainsRune(root, os.PathListSeparator) {
+		// Spaces and the like are fine everywhere, but this one splits
+		// PATH.
+		log.Printf("WARNING: %s contains %q, so toolchains under it cannot be found through %s; set GOVER_ROOT to a directory without it", root, os.PathListSeparator, gover.PathVar())
+	}
+	if *rootFlag != "" {
+		if err := gover.CheckWritable(root); err != nil && !dryRun {
+			log.Fatalf("gover: --root is not usable: %v", err)
+		}
+		// Have gover run by the commands gover runs use it too.
+		os.Setenv("GOVER_ROOT", root)
+	} else if os.Getenv("GOVER_ROOT") != "" && !dryRun {
+		if err := gover.CheckWritable(root); err != nil {
+			log.Fatalf("gover: GOVER_ROOT is not usable: %v", err)
+		}
+	}
+
+	cache := gover.CacheDir(root)
+	if !dryRun {
+		if err := gover.MkdirAll(cache); err != nil {
+			log.Fatalf("gover: failed to create cache directory: %v", err)
+		}
+		gover.CleanStaleParts(cache)
 	}
+	debugf("using cache %s", cache)
 
-	_ = protect.Pledge("stdio tty unveil rpath cpath wpath proc dns inet fattr exec")
+	// The sandbox is only a safeguard, so carry on without it, except
+	// where that would leave gover unable to reach its own files.
+	if err := protect.Pledge("stdio tty unveil rpath cpath wpath proc dns inet fattr exec"); err != nil {
+		debugf("pledge failed, running without it: %v", err)
+	}
 
-	_ = protect.Unveil("/etc", "r")
-	_ = protect.Unveil(root, "rwxc")
-	_ = protect.UnveilBlock()
+	unveil := func(path, perms string) {
+		if err := protect.Unveil(path, perms); err != nil {
+			debugf("unveil %s %q failed: %v", path, perms, err)
+		}
+	}
+	unveil("/etc", "r")
+	// Run tells from it whether interrupts reach the go command directly.
+	unveil("/dev/tty", "r")
+	if err := protect.Unveil(root, "rwxc"); err != nil && !dryRun {
+		log.Fatalf("gover: cannot unveil %s: %v; check that it is a directory gover can access", root, err)
+	}
+	unveil(cache, "rwc")
+	// A local archive given to "download --from" lives outside of root.
+	if from := flagValue(os.Args[1:], "from"); from != "" {
+		unveil(from, "r")
+		unveil(from+".asc", "r")
+	}
+	// So do toolchains installed with "download --dest", which are
+	// staged next to their destination, and reinstalled there.
+	if dest := flagValue(os.Args[1:], "dest"); dest != "" {
+		if abs, err := filepath.Abs(dest); err == nil {
+			unveil(filepath.Dir(abs), "rwxc")
+		}
+	}
+	if entries, err := os.ReadDir(root); err == nil {
+		for _, entry := range entries {
+			if tgt, err := os.Readlink(filepath.Join(root, entry.Name())); err == nil && filepath.IsAbs(tgt) {
+				unveil(filepath.Dir(tgt), "rwxc")
+			}
+		}
+	}
+	// Builds from source bootstrap with the go on PATH, if it will do,
+	// and "gover exec" runs commands from PATH; finding and running them
+	// takes looking through PATH.
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir != "" {
+			unveil(dir, "rx")
+		}
+	}
+	// "gover exec" may also be given a command by its path.
+	if len(os.Args) > 1 && os.Args[1] == "exec" {
+		args := os.Args[2:]
+		if len(args) > 1 && args[1] == "--" {
+			args = args[1:]
+		}
+		if len(args) > 1 && strings.ContainsAny(args[1], `/\`) {
+			unveil(args[1], "rx")
+		}
+	}
+	// Version pins may be in any directory above the current one.
+	if wd, err := os.Getwd(); err == nil {
+		for dir := wd; ; dir = filepath.Dir(dir) {
+			unveil(filepath.Join(dir, pinFileName), "r")
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	if err := protect.UnveilBlock(); err != nil {
+		debugf("locking unveil failed: %v", err)
+	}
 
 	if len(os.Args) == 1 {
-		log.Fatalf("gover: usage: gover [download|version|list]")
-		os.Exit(1)
+		usagef("usage: gover [download|version|list|list-files|search|info|remove|prune|use|rename|reinstall|upgrade|exec|run|verify|which|doctor|clean|clean-cache|update-keys]")
+	}
+
+	// Check the embedded signing keys before any command that needs them, so
+	// a broken build of gover fails right away rather than after a download.
+	switch os.Args[1] {
+	case "download", "upgrade", "reinstall", "verify", "update-keys":
+		if err := gover.CheckEmbeddedKeys(); err != nil {
+			fatal(err)
+		}
 	}
 
 	if os.Args[1] == "env" {
-		if len(os.Args) != 3 {
-			log.Fatalf("gover: usage: gover download [version]")
+		flags := flag.NewFlagSet("env", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "print the environment as JSON")
+		parseFlags(flags, os.Args[2:])
+		if flags.NArg() != 1 {
+			usagef("usage: gover env [--json] [version]")
 		}
-		version = os.Args[2]
+		version = flags.Arg(0)
 		if version == "latest" {
-			if version, err = getLatestGoVersion(); err != nil {
-				log.Fatalf("gover: %v", err)
+			if version, err = gover.LatestVersion(root); err != nil {
+				fatal(err)
 			}
 			version = strings.TrimPrefix(version, "go")
+		} else if v := gover.InstalledSeries(root, version); v != "" {
+			version = v
+		}
+		gr, newPath := gover.Paths(root, version)
+		extra, err := gover.ExtraEnv()
+		if err != nil {
+			fatal(err)
+		}
+		if *asJSON {
+			m := map[string]string{}
+			for _, kv := range extra {
+				k, v, _ := strings.Cut(kv, "=")
+				m[k] = v
+			}
+			m["GOROOT"], m[gover.PathVar()] = gr, newPath
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			if err := enc.Encode(m); err != nil {
+				fatal(err)
+			}
+		} else {
+			for _, kv := range extra {
+				if k, _, _ := strings.Cut(kv, "="); k != "GOROOT" && k != gover.PathVar() {
+					fmt.Println(kv)
+				}
+			}
+			fmt.Printf("GOROOT=%s\n", gr)
+			fmt.Printf("%s=%s\n", gover.PathVar(), newPath)
 		}
-		gr := filepath.Join(root, version, "go")
-		fmt.Printf("GOROOT=%s\n", gr)
-
-		origPath := strings.Split(os.Getenv("PATH"), ":")
-		origPath = slices.DeleteFunc(origPath, func(s string) bool {
-			return strings.Contains(s, root)
-		})
-
-		fmt.Printf("PATH=%s:%s\n", filepath.Join(gr, "bin"), strings.Join(origPath, ":"))
 		os.Exit(0)
 	}
 
 	if os.Args[1] == "download" {
-		switch len(os.Args) {
-		case 3:
-			version = os.Args[2]
+		var opts gover.InstallOptions
+		flags := flag.NewFlagSet("download", flag.ContinueOnError)
+		flags.BoolVar(&opts.Binary, "binary", false, "install a prebuilt binary archive instead of building from source")
+		flags.IntVar(&opts.Jobs, "jobs", 0, "number of CPUs the build may use (default all)")
+		flags.BoolVar(&opts.VerifyOnly, "verify-only", false, "download and verify the archive without installing it")
+		flags.BoolVar(&opts.KeepArchive, "keep-archive", false, "keep the downloaded archive in the cache after installing")
+		allPatches := flags.Bool("all-patches", false, "install every release of the series given, such as 1.20")
+		dryRun := flags.Bool("dry-run", false, "only print what would be done, without downloading or installing anything")
+		flags.BoolVar(&opts.NoTests, "no-tests", false, "leave out Go's own test suite and testdata to save space")
+		flags.BoolVar(&opts.NoDocs, "no-docs", false, "leave out the doc directory to save space")
+		flags.StringVar(&opts.From, "from", "", "install from a local archive instead of downloading")
+		flags.StringVar(&opts.GOOS, "os", "", "operating system of the binary archive (default host)")
+		flags.StringVar(&opts.GOARCH, "arch", "", "architecture of the binary archive (default host)")
+		flags.BoolVar(&opts.Quiet, "quiet", false, "only show the build output if the build fails")
+		deadline := flags.Duration("deadline", 0, "give up if downloading and building take longer than this")
+		flags.DurationVar(&opts.DownloadTimeout, "timeout-download", 0, "give up if downloading takes longer than this (default no limit)")
+		flags.DurationVar(&opts.BuildTimeout, "timeout-build", 0, "give up if building takes longer than this (default no limit)")
+		flags.BoolVar(&opts.InsecureSkipVerify, "insecure-skip-verify", false, "do NOT check the archive's signature; for testing archives you trust only")
+		warm := flags.Bool("warm", false, "prime the build cache by building the standard library after installing")
+		warmModule := flags.String("warm-module", "", "also download the dependencies of the module in this directory (implies --warm)")
+		progress := flags.String("progress", "", "set to json to report progress as JSON lines on stdout")
+		makeArgs := flags.String("make-args", "", "space-separated arguments for the make script, such as --no-clean")
+		flags.StringVar(&opts.CC, "cc", "", "C compiler to build with and to use for cgo, such as clang")
+		flags.StringVar(&opts.CXX, "cxx", "", "C++ compiler to build with and to use for cgo, such as clang++")
+		flags.StringVar(&opts.Dest, "dest", "", "install into this directory instead of under the gover root")
+		yes := flags.Bool("yes", false, "do not ask before large downloads")
+		flags.StringVar(&opts.Checksum, "checksum", "", "SHA256 the archive must have, in hex")
+		parseFlags(flags, os.Args[2:])
+		// For CI matrices, the platform may come from the environment
+		// instead; the flags win. Staging only works with binary
+		// archives, so a foreign platform set this way implies --binary.
+		if opts.GOOS == "" && opts.GOARCH == "" {
+			opts.GOOS, opts.GOARCH = os.Getenv("GOVER_GOOS"), os.Getenv("GOVER_GOARCH")
+			if (opts.GOOS != "" || opts.GOARCH != "") && !gover.IsHost(opts.GOOS, opts.GOARCH) && !opts.Binary {
+				debugf("GOVER_GOOS/GOVER_GOARCH select %s/%s; installing a binary archive", opts.GOOS, opts.GOARCH)
+				opts.Binary = true
+			}
+		}
+		if opts.Checksum != "" {
+			if b, err := hex.DecodeString(opts.Checksum); err != nil || len(b) != sha256.Size {
+				usagef("invalid --checksum %q: expected a SHA256 as 64 hex digits", opts.Checksum)
+			}
+		}
+		opts.MakeArgs = strings.Fields(*makeArgs)
+		if len(opts.MakeArgs) > 0 && opts.Binary {
+			usagef("--make-args only applies to builds from source, not --binary")
+		}
+		if (opts.CC != "" || opts.CXX != "") && opts.Binary {
+			usagef("--cc and --cxx only apply to builds from source, not --binary")
+		}
+		switch *progress {
+		case "":
+		case "json":
+			gover.ProgressJSON = true
+		default:
+			usagef("unknown --progress %q; only json is supported", *progress)
+		}
+		if opts.Dest != "" {
+			if opts.VerifyOnly {
+				usagef("--dest does not apply to --verify-only")
+			}
+			if opts.Dest, err = filepath.Abs(opts.Dest); err != nil {
+				fatal(err)
+			}
+		}
+		if !*yes && !gover.ProgressJSON && isTerminal(os.Stdin) {
+			opts.ConfirmDownload = confirmDownload
+		}
+		if opts.InsecureSkipVerify && opts.VerifyOnly {
+			usagef("--verify-only and --insecure-skip-verify contradict each other")
+		}
+		*warm = *warm || *warmModule != ""
+		if *warm && (opts.VerifyOnly || !gover.IsHost(opts.GOOS, opts.GOARCH)) {
+			usagef("--warm needs a toolchain installed for this machine")
+		}
+		// The build runs in a process group of its own, which does not
+		// see ^C; cancel it instead.
+		ctx, stop := signal.NotifyContext(context.Background(), gover.ForwardedSignals...)
+		defer stop()
+		if *deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *deadline)
+			defer cancel()
+		}
+		if opts.GOOS != "" || opts.GOARCH != "" {
+			if opts.GOOS == "" {
+				opts.GOOS = runtime.GOOS
+			}
+			if opts.GOARCH == "" {
+				opts.GOARCH = runtime.GOARCH
+			}
+			if err := gover.CheckPlatform(opts.GOOS, opts.GOARCH); err != nil {
+				usagef("%v", err)
+			}
+		}
+		// A dry run makes do with the release feed cached by earlier runs.
+		gover.Offline = *dryRun
+		if *allPatches {
+			if flags.NArg() != 1 || !gover.IsSeries(flags.Arg(0)) {
+				usagef("--all-patches needs a release series such as 1.20")
+			}
+			if opts.From != "" || opts.Dest != "" || opts.Checksum != "" || *warm {
+				usagef("--all-patches cannot be combined with --from, --dest, --checksum or --warm")
+			}
+			if *dryRun {
+				versions, err := gover.Patches(root, flags.Arg(0))
+				if err != nil {
+					fatal(err)
+				}
+				for _, v := range versions {
+					if err := printPlan(root, v, opts, nil); err != nil {
+						fatal(err)
+					}
+				}
+				os.Exit(0)
+			}
+			if err := installPatches(ctx, root, flags.Arg(0), opts); err != nil {
+				fatal(err)
+			}
+			os.Exit(0)
+		}
+		if opts.From != "" {
+			f, err := os.Open(opts.From)
+			if err != nil {
+				fatal(err)
+			}
+			f.Close()
+		}
+		switch flags.NArg() {
+		case 1:
+			version = gover.ReleaseVersion(flags.Arg(0))
 			if version == "latest" {
-				if version, err = getLatestGoVersion(); err != nil {
-					log.Fatalf("gover: %v", err)
+				if version, err = gover.LatestVersion(root); err != nil {
+					fatal(err)
 				}
 				// Trim the leading "go" from the version number so it matches
 				// our expected format of X.Y.Z
 				version = strings.TrimPrefix(version, "go")
 				log.Printf("Latest Go version is %v", version)
+			} else if gover.IsSeries(version) {
+				if version, err = gover.LatestPatch(root, version); err != nil {
+					fatal(err)
+				}
+				log.Printf("Latest Go %s release is %v", flags.Arg(0), version)
+			}
+			if *dryRun {
+				var then []string
+				if flags.Arg(0) == "latest" && !opts.VerifyOnly {
+					then = append(then, "point latest at it")
+				}
+				if *warm {
+					then = append(then, "build the standard library to warm the build cache")
+				}
+				if *warmModule != "" {
+					then = append(then, "download the dependencies of the module in "+*warmModule)
+				}
+				if err := printPlan(root, version, opts, then); err != nil {
+					fatal(err)
+				}
+				os.Exit(0)
 			}
-			if err := installVer(root, version); err != nil {
-				log.Fatalf("gover: %v", err)
+			if err := gover.Install(ctx, root, version, opts); err != nil {
+				gover.EmitProgress(gover.ProgressEvent{Event: "failed", Version: version, Error: err.Error()})
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					fatal(fmt.Errorf("gave up on Go %s after the --deadline of %v: %w", version, *deadline, err))
+				}
+				fatal(err)
 			}
 			// Create a symlink from "latest" to the installed version if we
 			// were invoked with "latest"
-			if os.Args[2] == "latest" {
-				log.Println("Creating a symlink", filepath.Join(root, "latest"), "to", version)
-				// Ignore errors deleting the existing symlink; if there really
-				// is a problem, os.Symlink will error about it too.
-				_ = os.Remove(filepath.Join(root, "latest"))
-				if err := os.Symlink(version, filepath.Join(root, "latest")); err != nil {
+			if flags.Arg(0) == "latest" && !opts.VerifyOnly {
+				if err := gover.LinkLatest(root, version); err != nil {
 					log.Fatalln(err)
 				}
 			}
 		default:
-			log.Fatalf("gover: usage: gover download [version]")
+			usagef("usage: gover download [--binary [--os GOOS] [--arch GOARCH]] [--jobs N] [--make-args ARGS] [--cc CC] [--cxx CXX] [--quiet] [--deadline D] [--timeout-download D] [--timeout-build D] [--verify-only] [--keep-archive] [--all-patches] [--dry-run] [--no-tests] [--no-docs] [--dest dir] [--from archive] [--checksum SHA256] [--yes] [--warm [--warm-module dir]] [--progress json] [version]")
+		}
+		if *warm {
+			if err := gover.WarmCache(ctx, root, version, *warmModule); err != nil {
+				gover.EmitProgress(gover.ProgressEvent{Event: "failed", Version: version, Error: err.Error()})
+				log.Fatalf("gover: installed Go %s, but failed to warm the caches: %v", version, err)
+			}
+		}
+		gover.EmitProgress(gover.ProgressEvent{Event: "done", Version: version})
+		if opts.VerifyOnly {
+			log.Printf("Verified %s.", version)
+			os.Exit(0)
+		}
+		if !gover.IsHost(opts.GOOS, opts.GOARCH) {
+			log.Printf("Success. Staged Go %s for %s/%s in %s", version, opts.GOOS, opts.GOARCH, filepath.Join(root, gover.InstallName(version, opts.GOOS, opts.GOARCH)))
+			os.Exit(0)
 		}
 		log.Printf("Success. You may now run 'gover %s'!", version)
 		os.Exit(0)
 	}
 
 	if os.Args[1] == "list" {
-		entries, err := os.ReadDir(root)
+		flags := flag.NewFlagSet("list", flag.ContinueOnError)
+		remote := flags.Bool("remote", false, "list versions available for download")
+		beta := flags.Bool("include-beta", false, "include unstable releases with --remote")
+		asJSON := flags.Bool("json", false, "print installed versions as JSON")
+		size := flags.Bool("size", false, "show the disk usage of each version, largest first")
+		platform := flags.Bool("platform", false, "show the platform each version runs on")
+		installedOnly := flags.Bool("installed-only", false, "list only toolchains, not aliases or the version in use")
+		parseFlags(flags, os.Args[2:])
+		if *remote {
+			if err := listRemote(root, *beta, ""); err != nil {
+				fatal(err)
+			}
+			os.Exit(0)
+		}
+		versions, err := gover.List(root, *asJSON || *size)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		for _, entry := range entries {
-			finfo, err := entry.Info()
-			if err != nil {
+		if *installedOnly {
+			versions = slices.DeleteFunc(versions, func(v gover.Installed) bool {
+				return v.Kind != gover.KindToolchain
+			})
+		}
+		if *platform {
+			gover.AddPlatforms(root, versions)
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			if err := enc.Encode(versions); err != nil {
 				log.Fatalln(err)
 			}
-			// Dereference the "latest" symlink to the installed version
-			if entry.Name() == "latest" && finfo.Mode()&os.ModeSymlink != 0 {
-				tgt, err := os.Readlink(filepath.Join(root, entry.Name()))
-				if err != nil {
-					log.Fatalln(err)
+			os.Exit(0)
+		}
+		if *size {
+			slices.SortStableFunc(versions, func(a, b gover.Installed) int {
+				return cmp.Compare(b.Size, a.Size)
+			})
+			var total int64
+			for _, v := range versions {
+				if v.Target != "" {
+					fmt.Println(describeLink(v))
+					continue
 				}
-				fmt.Println(entry.Name(), "->", tgt)
+				if *platform {
+					fmt.Printf("%-24s %10s  %s\n", v.Version, gover.HumanBytes(v.Size), platformOrUnknown(v.Platform))
+				} else {
+					fmt.Printf("%-24s %10s\n", v.Version, gover.HumanBytes(v.Size))
+				}
+				total += v.Size
+			}
+			fmt.Printf("%-24s %10s\n", "total", gover.HumanBytes(total))
+			os.Exit(0)
+		}
+		for _, v := range versions {
+			// Dereference aliases and "current" to the installed
+			// version
+			if v.Target != "" {
+				fmt.Println(describeLink(v))
+			} else if *platform {
+				fmt.Printf("%-24s %s\n", v.Version, platformOrUnknown(v.Platform))
 			} else {
-				fmt.Println(entry.Name())
+				fmt.Println(v.Version)
+			}
+		}
+		os.Exit(0)
+	}
+	if os.Args[1] == "remove" {
+		flags := flag.NewFlagSet("remove", flag.ContinueOnError)
+		all := flags.Bool("all", false, "remove every version except the active one and, without --force, those in use")
+		force := flags.Bool("force", false, "do not ask for confirmation when removing by pattern, and remove versions in use")
+		parseFlags(flags, os.Args[2:])
+		switch {
+		case *all && flags.NArg() == 0:
+			if err := gover.RemoveAll(root, *force); err != nil {
+				fatal(err)
+			}
+		case !*all && flags.NArg() == 1 && gover.IsPattern(flags.Arg(0)):
+			versions, err := gover.Matching(root, flags.Arg(0))
+			if err != nil {
+				fatal(err)
+			}
+			if len(versions) == 0 {
+				log.Fatalf("gover: no installed version matches %s", flags.Arg(0))
+			}
+			if !*force {
+				checkNotInUse(root, versions...)
+				if !isTerminal(os.Stdin) {
+					log.Fatalf("gover: not removing %s without confirmation; pass --force", strings.Join(versions, ", "))
+				}
+				if !confirm("This removes:\n\t" + strings.Join(versions, "\n\t") + "\nContinue?") {
+					log.Fatalf("gover: not removing anything")
+				}
+			}
+			for _, v := range versions {
+				if err := gover.Remove(root, v); err != nil {
+					fatal(err)
+				}
+			}
+		case !*all && flags.NArg() == 1:
+			if !*force {
+				checkNotInUse(root, flags.Arg(0))
+			}
+			if err := gover.Remove(root, flags.Arg(0)); err != nil {
+				fatal(err)
+			}
+		default:
+			usagef("usage: gover remove [--all | [--force] version | [--force] pattern]")
+		}
+		os.Exit(0)
+	}
+	if os.Args[1] == "which" {
+		var version string
+		switch len(os.Args) {
+		case 2:
+			if version, err = gover.Current(root); err != nil {
+				fatal(err)
+			}
+			if version == "" {
+				log.Fatalf("gover: no version selected. Run 'gover use VERSION' first")
+			}
+		case 3:
+			version = os.Args[2]
+			if v := gover.InstalledSeries(root, version); v != "" {
+				version = v
+			}
+		default:
+			usagef("usage: gover which [version]")
+		}
+		gobin := filepath.Join(root, version, "go", "bin", "go"+gover.Exe())
+		if _, err := os.Stat(gobin); err != nil {
+			log.Fatalf("gover: version %s is not installed in %v", version, root)
+		}
+		fmt.Println(gobin)
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "exec" {
+		args := os.Args[2:]
+		if len(args) > 1 && args[1] == "--" {
+			args = append(args[:1:1], args[2:]...)
+		}
+		if len(args) < 2 {
+			usagef("usage: gover exec version [--] command [args...]")
+		}
+		version = args[0]
+		if !gover.IsVersionArg(root, version) {
+			usagef("%q is not a version", version)
+		}
+		if version, err = gover.Resolve(root, version); errors.Is(err, gover.ErrNotInstalled) {
+			log.Fatalf("gover: Go %s is not downloaded. Run 'gover download %s' to install it", version, version)
+		} else if err != nil {
+			fatal(err)
+		}
+		env, err := gover.Env(root, version)
+		if err != nil {
+			fatal(err)
+		}
+		// Look the command up in the toolchain's PATH, so that "go"
+		// in particular is the toolchain's.
+		_, newPath := gover.Paths(root, version)
+		os.Setenv(gover.PathVar(), newPath)
+		debugf("running %q with Go %s", args[1:], version)
+		// Signals are passed on to the command rather than stop it.
+		cmd := exec.Command(args[1], args[2:]...)
+		cmd.Env = env
+		runToolchain(root, version, cmd)
+	}
+
+	if os.Args[1] == "doctor" {
+		if !doctor(root) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "verify" {
+		if len(os.Args) != 3 {
+			usagef("usage: gover verify version")
+		}
+		if err := gover.Verify(root, os.Args[2]); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "prune" {
+		flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+		keep := flags.Int("keep", 0, "number of the newest versions to keep")
+		dryRun := flags.Bool("dry-run", false, "only print what would be removed")
+		force := flags.Bool("force", false, "also remove versions another gover is installing or running")
+		parseFlags(flags, os.Args[2:])
+		if *keep < 1 || flags.NArg() != 0 {
+			usagef("usage: gover prune --keep N [--dry-run] [--force]")
+		}
+		if err := gover.Prune(root, *keep, *dryRun, *force); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "completion" {
+		if len(os.Args) != 3 {
+			usagef("usage: gover completion [bash|zsh|fish]")
+		}
+		script, err := completionScript(os.Args[2])
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Print(script)
+		os.Exit(0)
+	}
+	if os.Args[1] == "update-keys" {
+		if len(os.Args) != 2 {
+			usagef("usage: gover update-keys")
+		}
+		file, err := gover.UpdateKeys(root)
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("Success. Stored the current signing key in %s.", file)
+		os.Exit(0)
+	}
+	if os.Args[1] == "clean" {
+		flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+		dryRun := flags.Bool("dry-run", false, "only print what would be removed")
+		parseFlags(flags, os.Args[2:])
+		if flags.NArg() != 0 {
+			usagef("usage: gover clean [--dry-run]")
+		}
+		if err := gover.Clean(root, *dryRun); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+	if os.Args[1] == "clean-cache" {
+		if err := gover.CleanCache(root); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+	if os.Args[1] == "use" {
+		switch len(os.Args) {
+		case 2:
+			cur, err := gover.Current(root)
+			if err != nil {
+				fatal(err)
+			}
+			if cur == "" {
+				log.Fatalf("gover: no version selected. Run 'gover use VERSION' first")
+			}
+			fmt.Println(cur)
+		case 3:
+			if err := gover.Use(root, os.Args[2]); err != nil {
+				fatal(err)
+			}
+		default:
+			usagef("usage: gover use [version]")
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "reinstall" {
+		var opts gover.InstallOptions
+		flags := flag.NewFlagSet("reinstall", flag.ContinueOnError)
+		force := flags.Bool("force", false, "do not ask for confirmation")
+		flags.BoolVar(&opts.Binary, "binary", false, "install a prebuilt binary archive instead of building from source")
+		flags.IntVar(&opts.Jobs, "jobs", 0, "number of CPUs the build may use (default all)")
+		flags.BoolVar(&opts.Quiet, "quiet", false, "only show the build output if the build fails")
+		parseFlags(flags, os.Args[2:])
+		if flags.NArg() != 1 {
+			usagef("usage: gover reinstall [--force] [--binary] [--jobs N] [--quiet] version")
+		}
+		var ask func(dir, version string) bool
+		if !*force {
+			if !isTerminal(os.Stdin) {
+				log.Fatalf("gover: not reinstalling %s without confirmation; pass --force", flags.Arg(0))
+			}
+			ask = func(dir, version string) bool {
+				return confirm(fmt.Sprintf("This removes %s and its downloaded archives, then downloads and installs Go %s again.\nIf that fails, Go %s is no longer installed. Continue?", dir, version, version))
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), gover.ForwardedSignals...)
+		defer stop()
+		version, err := gover.Reinstall(ctx, root, flags.Arg(0), ask, opts)
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("Success. Reinstalled Go %s.", version)
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "info" {
+		if len(os.Args) != 3 {
+			usagef("usage: gover info version")
+		}
+		if err := info(root, os.Args[2]); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "list-files" {
+		flags := flag.NewFlagSet("list-files", flag.ContinueOnError)
+		tree := flags.Bool("tree", false, "list every file and directory as a tree")
+		parseFlags(flags, os.Args[2:])
+		if flags.NArg() != 1 {
+			usagef("usage: gover list-files [--tree] version")
+		}
+		if err := listFiles(root, flags.Arg(0), *tree); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "search" {
+		flags := flag.NewFlagSet("search", flag.ContinueOnError)
+		beta := flags.Bool("include-beta", false, "include unstable releases")
+		parseFlags(flags, os.Args[2:])
+		if flags.NArg() != 1 {
+			usagef("usage: gover search [--include-beta] text")
+		}
+		if err := listRemote(root, *beta, flags.Arg(0)); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "rename" {
+		if len(os.Args) != 4 {
+			usagef("usage: gover rename version alias")
+		}
+		// Aliases must not shadow gover's own commands.
+		if alias := os.Args[3]; slices.Contains(subcommands, alias) || alias == "version" {
+			usagef("alias %q is a gover command", alias)
+		}
+		if err := gover.Alias(root, os.Args[2], os.Args[3]); err != nil {
+			fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if os.Args[1] == "upgrade" {
+		var opts gover.InstallOptions
+		flags := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+		minor := flags.Bool("minor", false, "move to the newest minor release rather than the newest patch")
+		use := flags.Bool("use", false, "select the upgraded version with 'gover use'")
+		flags.BoolVar(&opts.Binary, "binary", false, "install a prebuilt binary archive instead of building from source")
+		flags.IntVar(&opts.Jobs, "jobs", 0, "number of CPUs the build may use (default all)")
+		flags.BoolVar(&opts.Quiet, "quiet", false, "only show the build output if the build fails")
+		flags.BoolVar(&opts.KeepArchive, "keep-archive", false, "keep the downloaded archive in the cache after installing")
+		parseFlags(flags, os.Args[2:])
+		var cur string
+		switch flags.NArg() {
+		case 0:
+			if cur, err = gover.Current(root); err != nil {
+				fatal(err)
+			}
+			if cur == "" {
+				log.Fatalf("gover: no version selected. Run 'gover use VERSION' first, or name the version to upgrade")
+			}
+		case 1:
+			cur = flags.Arg(0)
+		default:
+			usagef("usage: gover upgrade [--minor] [--use] [--binary] [--jobs N] [--quiet] [--keep-archive] [version]")
+		}
+		next, err := gover.UpgradeVersion(root, cur, *minor)
+		if err != nil {
+			fatal(err)
+		}
+		if next == "" {
+			log.Printf("Go %s is already up to date.", cur)
+			os.Exit(0)
+		}
+		if _, err := os.Stat(filepath.Join(root, next, "go", "bin", "go"+gover.Exe())); err == nil {
+			log.Printf("Go %s is already installed", next)
+		} else {
+			log.Printf("Upgrading Go %s to %s", cur, next)
+			ctx, stop := signal.NotifyContext(context.Background(), gover.ForwardedSignals...)
+			defer stop()
+			if err := gover.Install(ctx, root, next, opts); err != nil {
+				fatal(err)
 			}
 		}
+		if *use {
+			if err := gover.Use(root, next); err != nil {
+				fatal(err)
+			}
+		}
+		log.Printf("Success. You may now run 'gover %s'!", next)
 		os.Exit(0)
 	}
 	version = os.Args[1]
-	gobin := filepath.Join(root, version, "go", "bin", "go"+exe())
-	gorootPath := filepath.Join(root, version, "go")
-	if _, err := os.Stat(gobin); err != nil {
+	args := os.Args[2:]
+	pinFile := ""
+	if version == "run" && len(args) > 0 && gover.IsVersionArg(root, args[0]) {
+		// "gover run VERSION [--] ARGS..." spells out where the version
+		// ends, for scripts passing go arguments such as "version" or
+		// "list". Without a version after it, "run" is go run as usual.
+		version, args = args[0], args[1:]
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
+	} else if !gover.IsVersionArg(root, version) {
+		// Without an explicit version, use the one pinned for the
+		// current directory or the default, and pass every argument
+		// on to go.
+		v, file, err := pinnedVersion()
+		if err == nil && file == "" {
+			v, file, err = defaultVersion(root)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if file == "" {
+			if version == "run" {
+				usagef("usage: gover run version [--] [go args...]")
+			}
+			msg := fmt.Sprintf("gover: unknown command %q", version)
+			if sc := closestSubcommand(version); sc != "" {
+				msg += fmt.Sprintf("; did you mean %q?", sc)
+			}
+			log.Printf("%s\nValid commands are: %s, or a version such as 1.21.0\nTo run go commands without naming a version, select one with 'gover use VERSION'", msg, strings.Join(subcommands, ", "))
+			os.Exit(exitUsage)
+		}
+		if !gover.IsVersionArg(root, v) {
+			log.Fatalf("gover: %s does not name a version: %q", file, v)
+		}
+		version, args, pinFile = v, os.Args[1:], file
+	}
+	// Interrupting gover stops the install below, if any; the go command
+	// gets the signal itself.
+	ctx, stop := signal.NotifyContext(context.Background(), gover.ForwardedSignals...)
+	defer stop()
+	if version, err = gover.Resolve(root, version); err != nil {
+		if !errors.Is(err, gover.ErrNotInstalled) {
+			fatal(err)
+		}
 		if g := os.Getenv("GOVER_FETCH_MISSING"); g == "Yes" {
-			if err := installVer(root, version); err != nil {
-				log.Fatalf("gover: %v", err)
+			if err := gover.CheckEmbeddedKeys(); err != nil {
+				fatal(err)
 			}
+			v := version
+			if version == "latest" {
+				if v, err = gover.LatestVersion(root); err != nil {
+					fatal(err)
+				}
+				v = strings.TrimPrefix(v, "go")
+				log.Printf("Latest Go version is %v", v)
+			} else if gover.IsSeries(version) {
+				if v, err = gover.LatestPatch(root, version); err != nil {
+					fatal(err)
+				}
+				log.Printf("Latest Go %s release is %v", version, v)
+			}
+			// Stdout is the toolchain's, as for go test -json; keep the
+			// install from writing to it.
+			gover.HumanOutput = os.Stderr
+			if err := gover.Install(ctx, root, v, gover.InstallOptions{}); err != nil {
+				fatal(err)
+			}
+			if version == "latest" {
+				if err := gover.LinkLatest(root, v); err != nil {
+					fatal(err)
+				}
+			} else {
+				version = v
+			}
+		} else if pinFile != "" {
+			log.Fatalf("gover: %s selects Go %s, which is not downloaded. Run 'gover download %s' to install it", pinFile, version, version)
 		} else {
 			log.Fatalf("gover: not downloaded. Run 'gover download' to install to %v", root)
 		}
 	}
-	cmd := exec.Command(gobin, os.Args[2:]...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	newPath := filepath.Join(root, version, "go", "bin")
-	if p := os.Getenv("PATH"); p != "" {
-		newPath += string(filepath.ListSeparator) + p
-	}
-	cmd.Env = dedupEnv(caseInsensitiveEnv, append(os.Environ(), "GOROOT="+gorootPath, "PATH="+newPath))
-	if err := cmd.Run(); err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
-			// TODO: return the same exit status maybe.
-			os.Exit(1)
-		}
-		log.Fatalf("gover: failed to execute %v: %v", gobin, err)
+	cmd, err := gover.Command(context.Background(), root, version, args...)
+	if err != nil {
+		fatal(err)
 	}
-	os.Exit(0)
+	debugf("running %s %q", cmd.Path, args)
+	runToolchain(root, version, cmd)
 }
 
-// Copied from https://go.googlesource.com/tools/+/master/cmd/getgo/download.go
-func getLatestGoVersion() (string, error) {
-	resp, err := http.Get("https://go.dev/dl/?mode=json")
+// printPlan prints what installing version with opts would do, as worked
+// out by gover.PlanInstall, followed by the steps in then.
+func printPlan(root, version string, opts gover.InstallOptions, then []string) error {
+	plan, err := gover.PlanInstall(root, version, opts)
 	if err != nil {
-		return "", fmt.Errorf("Getting current Go version failed: %v", err)
+		return fmt.Errorf("Go %s: %v", version, err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return "", fmt.Errorf("Could not get current Go release: HTTP %d: %q", resp.StatusCode, b)
+	fmt.Printf("Go %s:\n", version)
+	step := func(format string, args ...interface{}) {
+		fmt.Printf("  - "+format+"\n", args...)
 	}
-	var releases []struct {
-		Version string
+	size := ""
+	if plan.File.Size > 0 {
+		size = " (" + gover.HumanBytes(plan.File.Size) + ")"
 	}
-	err = json.NewDecoder(resp.Body).Decode(&releases)
-	if err != nil {
-		return "", err
+	switch {
+	case plan.Installed && opts.Binary:
+		step("already installed in %s; nothing to do", plan.Dest)
+		return nil
+	case plan.Installed:
+		step("already installed in %s; rebuild it in place", plan.Dest)
+	case opts.From != "":
+		step("use the local archive %s", plan.Archive)
+	case plan.Cached:
+		step("use %s%s, downloaded before to %s", plan.Archive, size, gover.CacheDir(root))
+	default:
+		step("download %s%s from %s", plan.Archive, size, plan.URLs[0])
+		if len(plan.URLs) > 1 {
+			step("or else from %s", strings.Join(plan.URLs[1:], ", "))
+		}
+	}
+	switch {
+	case plan.Installed:
+	case opts.InsecureSkipVerify:
+		step("do NOT verify its signature (--insecure-skip-verify)")
+	case opts.From != "":
+		step("verify it if %s.asc holds its signature", plan.Archive)
+	default:
+		step("verify its signature")
+	}
+	if opts.VerifyOnly {
+		step("keep it in %s without installing it", gover.CacheDir(root))
+		return nil
+	}
+	if !plan.Installed {
+		where := plan.Dest
+		if plan.Link != "" {
+			where += ", linked from " + plan.Link
+		}
+		switch {
+		case opts.NoTests && opts.NoDocs:
+			where += ", without tests and docs"
+		case opts.NoTests:
+			where += ", without tests"
+		case opts.NoDocs:
+			where += ", without docs"
+		}
+		step("extract it into %s", where)
+	}
+	switch {
+	case plan.Binary:
+		step("use the prebuilt toolchain as is")
+	case opts.From != "":
+		step("build it from source unless it is a binary archive")
+	case plan.Bootstrap != "":
+		step("build it from source, bootstrapping with %s", plan.Bootstrap)
+	default:
+		step("build it from source")
 	}
-	if len(releases) < 1 {
-		return "", fmt.Errorf("Could not get at least one Go release")
+	for _, s := range then {
+		step("%s", s)
 	}
-	return releases[0].Version, nil
+	return nil
 }
-func fetch(a, b string) (*os.File, error) {
-	fmt.Printf("Fetching %q\n", a)
-	f, err := os.Create(b)
+
+// installPatches installs every release of series in turn, skipping those
+// already installed, and sums up what it did. It keeps going when one
+// fails, but fails itself if any did.
+func installPatches(ctx context.Context, root, series string, opts gover.InstallOptions) error {
+	versions, err := gover.Patches(root, series)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	var installed, skipped, failed []string
+	for _, v := range versions {
+		if !opts.VerifyOnly && gover.IsInstalled(root, gover.InstallName(v, opts.GOOS, opts.GOARCH)) {
+			skipped = append(skipped, v)
+			continue
+		}
+		log.Printf("Installing Go %s", v)
+		if err := gover.Install(ctx, root, v, opts); err != nil {
+			gover.EmitProgress(gover.ProgressEvent{Event: "failed", Version: v, Error: err.Error()})
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("gover: %v", err)
+			failed = append(failed, v)
+			continue
+		}
+		gover.EmitProgress(gover.ProgressEvent{Event: "done", Version: v})
+		installed = append(installed, v)
+	}
+	done := "Installed"
+	if opts.VerifyOnly {
+		done = "Verified"
+	}
+	for _, s := range []struct {
+		what string
+		vers []string
+	}{{done, installed}, {"Already installed", skipped}, {"Failed", failed}} {
+		if len(s.vers) > 0 {
+			log.Printf("%s: %s", s.what, strings.Join(s.vers, ", "))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d releases of Go %s failed to install", len(failed), len(versions), series)
+	}
+	return nil
+}
 
-	fResp, err := http.Get(a)
-	if err != nil {
-		return nil, err
+// Exit statuses for gover's own failures, so that scripts can tell a
+// transient failure from one that won't go away by trying again. Other
+// failures exit with status 1.
+const (
+	exitNetwork      = 2
+	exitVerification = 3
+	exitBuild        = 4
+	exitUsage        = 5
+)
+
+// exitCode returns the exit status for err.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, gover.ErrNetwork):
+		return exitNetwork
+	case errors.Is(err, gover.ErrVerification):
+		return exitVerification
+	case errors.Is(err, gover.ErrBuild):
+		return exitBuild
 	}
+	return 1
+}
 
-	defer fResp.Body.Close()
+// fatal reports err and exits with its exit status.
+func fatal(err error) {
+	log.Printf("gover: %v", err)
+	os.Exit(exitCode(err))
+}
+
+// usagef reports a mistake in how gover was invoked and exits with
+// exitUsage.
+func usagef(format string, args ...interface{}) {
+	log.Printf("gover: "+format, args...)
+	os.Exit(exitUsage)
+}
 
-	if _, err := io.Copy(f, fResp.Body); err != nil {
-		return nil, err
+// parseFlags parses args into flags, exiting with exitUsage if they are
+// invalid. The flag package has already explained why.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(exitUsage)
 	}
+}
 
-	_, err = f.Seek(0, 0)
+// runToolchain runs cmd, which uses the toolchain version under root, in
+// the foreground, forwarding signals to it. It then exits with the status a
+// shell would report for cmd: its exit status, or 128 plus the number of
+// the signal that killed it.
+func runToolchain(root, version string, cmd *exec.Cmd) {
+	// The command gets gover's own file descriptors rather than pipes, so
+	// its output is not copied, buffered or translated on the way: it
+	// streams byte for byte, as for go test -json.
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Keep "gover remove" from removing the toolchain meanwhile.
+	done := gover.MarkInUse(root, version)
+	err := gover.Run(cmd)
+	done()
 	if err != nil {
-		return nil, err
+		if ee, ok := err.(*exec.ExitError); ok {
+			if code := gover.ExitStatus(ee.ProcessState); code > 0 {
+				os.Exit(code)
+			}
+			os.Exit(1)
+		}
+		log.Fatalf("gover: failed to execute %v: %v", cmd.Path, err)
 	}
-
-	return f, nil
+	os.Exit(0)
 }
-func fetchify(goURL string, fp string) error {
-	buf := bytes.NewBufferString(pubKey)
-	kr, err := openpgp.ReadArmoredKeyRing(buf)
+
+// pinFileName is the name of the file pinning a directory tree to a version.
+const pinFileName = ".gover-version"
+
+// pinnedVersion looks for a .gover-version file in the current directory
+// and its parents, and returns the version named in the nearest one along
+// with its path. It returns an empty path if there is no such file.
+func pinnedVersion() (string, string, error) {
+	dir, err := os.Getwd()
 	if err != nil {
-		return err
+		return "", "", err
 	}
+	for {
+		file := filepath.Join(dir, pinFileName)
+		b, err := os.ReadFile(file)
+		if err == nil {
+			v := strings.TrimSpace(string(b))
+			if v == "" || strings.ContainsAny(v, `/\`) || strings.HasPrefix(v, ".") {
+				return "", "", fmt.Errorf("%s does not name a version", file)
+			}
+			return v, file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
 
-	tbz, err := fetch(goURL, fp)
-	if err != nil {
-		return err
+// defaultVersionFile is the name of the file under root naming the version
+// to run when no other is given.
+const defaultVersionFile = "default"
+
+// defaultVersion returns the version to run when neither the command line
+// nor a .gover-version file names one, along with where it was set:
+// GOVER_DEFAULT, the default file under root, or else the version selected
+// with "gover use". It returns empty strings if no default is set.
+func defaultVersion(root string) (string, string, error) {
+	if v := os.Getenv("GOVER_DEFAULT"); v != "" {
+		return v, "GOVER_DEFAULT", nil
 	}
-	sig, err := fetch(goURL+".asc", fp+".asc")
-	if err != nil {
-		return err
+	file := filepath.Join(root, defaultVersionFile)
+	b, err := os.ReadFile(file)
+	if err == nil {
+		return strings.TrimSpace(string(b)), file, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+	v, err := gover.Current(root)
+	if err != nil || v == "" {
+		return "", "", err
 	}
+	return v, "'gover use'", nil
+}
 
-	defer tbz.Close()
-	defer sig.Close()
+// describeLink describes an entry of the root that stands for a toolchain
+// elsewhere, for "gover list".
+func describeLink(v gover.Installed) string {
+	switch v.Kind {
+	case gover.KindAlias:
+		return fmt.Sprintf("%s -> %s (alias)", v.Version, v.Target)
+	case gover.KindCurrent:
+		return fmt.Sprintf("%s -> %s (selected with 'gover use')", v.Version, v.Target)
+	default:
+		return fmt.Sprintf("%s -> %s (installed elsewhere)", v.Version, v.Target)
+	}
+}
+
+// platformOrUnknown returns p, or "unknown" if it is empty.
+func platformOrUnknown(p string) string {
+	if p == "" {
+		return "unknown"
+	}
+	return p
+}
 
-	_, err = openpgp.CheckArmoredDetachedSignature(kr, tbz, sig)
+// listRemote prints the versions available for download that contain
+// match, marking those already installed under root.
+func listRemote(root string, includeBeta bool, match string) error {
+	releases, err := gover.Releases(root, true)
 	if err != nil {
 		return err
 	}
+	// Searches add the release dates and security fixes from the
+	// release history, if it can be had.
+	var notes map[string]gover.ReleaseNote
+	if match != "" {
+		if notes, err = gover.ReleaseNotes(root); err != nil {
+			log.Printf("Unable to fetch the release history, leaving out release dates: %v", err)
+		}
+	}
+	found := false
+	for _, r := range releases {
+		if !r.Stable && !includeBeta {
+			continue
+		}
+		version := strings.TrimPrefix(r.Version, "go")
+		if !strings.Contains(version, strings.TrimPrefix(match, "go")) {
+			continue
+		}
+		found = true
+		line := version
+		if notes != nil {
+			date, security := "", ""
+			if n, ok := notes[version]; ok {
+				date = n.Date.Format("2006-01-02")
+				if n.Security {
+					security = "security"
+				}
+			}
+			line = fmt.Sprintf("%-12s %-10s %-8s", version, date, security)
+		}
+		if _, err := os.Stat(filepath.Join(root, version, "go")); err == nil {
+			line += " (installed)"
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	if !found && match != "" {
+		return fmt.Errorf("no release matches %q", match)
+	}
+	return nil
+}
 
-	fmt.Println("Signature OK.")
-
-	_, err = tbz.Seek(0, 0)
+// info prints what is known about version: from the release feed, its
+// archives for building from source and for this platform, from the release
+// history its date and whether it fixes security issues, and whether it is
+// installed under root. Without the feed, it prints just the latter.
+func info(root, version string) error {
+	version = gover.ReleaseVersion(version)
+	var rel *gover.Release
+	releases, err := gover.Releases(root, true)
+	if err != nil {
+		log.Printf("Unable to fetch the release feed, showing only what is installed: %v", err)
+	}
+	for i, r := range releases {
+		if r.Version == "go"+version {
+			rel = &releases[i]
+		}
+	}
+	installed, err := gover.List(root, true)
 	if err != nil {
 		return err
 	}
+	var local *gover.Installed
+	var aliases []string
+	selected := false
+	for i, v := range installed {
+		switch {
+		case v.Version == version:
+			local = &installed[i]
+		case v.Target == version && v.Kind == gover.KindAlias:
+			aliases = append(aliases, v.Version)
+		case v.Target == version && v.Kind == gover.KindCurrent:
+			selected = true
+		}
+	}
+	if rel == nil && local == nil {
+		if releases == nil {
+			return fmt.Errorf("Go %s is not installed", version)
+		}
+		return fmt.Errorf("no release %s on go.dev; 'gover search' finds the ones there are", version)
+	}
 
-	return Untar(tbz, path.Dir(fp))
+	fmt.Printf("Version:   %s\n", version)
+	if rel != nil {
+		stable := "yes"
+		if !rel.Stable {
+			stable = "no (beta or release candidate)"
+		}
+		fmt.Printf("Stable:    %s\n", stable)
+		// The feed has no dates; the release history does.
+		notes, err := gover.ReleaseNotes(root)
+		if n, ok := notes[version]; ok {
+			security := "no"
+			if n.Security {
+				security = "yes, see https://go.dev/doc/devel/release"
+			}
+			fmt.Printf("Released:  %s\n", n.Date.Format("2006-01-02"))
+			fmt.Printf("Security:  %s\n", security)
+		} else if err != nil {
+			log.Printf("Unable to fetch the release history, leaving out the release date: %v", err)
+		}
+		for _, f := range rel.Files {
+			if f.Kind == "source" || (f.OS == runtime.GOOS && f.Arch == runtime.GOARCH && f.Kind == "archive") {
+				fmt.Printf("Archive:   %s, %s, SHA256 %s\n", f.Filename, gover.HumanBytes(f.Size), f.SHA256)
+			}
+		}
+	}
+	switch {
+	case local == nil:
+		fmt.Printf("Installed: no\n")
+	case local.Target != "":
+		// Installed elsewhere with --dest.
+		fmt.Printf("Installed: %s, linked from %s\n", local.Target, local.Path)
+	default:
+		fmt.Printf("Installed: %s, %s\n", local.Path, gover.HumanBytes(local.Size))
+	}
+	if len(aliases) > 0 {
+		fmt.Printf("Aliases:   %s\n", strings.Join(aliases, ", "))
+	}
+	if selected {
+		fmt.Printf("Selected:  yes, with 'gover use'\n")
+	}
+	return nil
 }
-func installVer(root, version string) error {
-	goURL := fmt.Sprintf("https://dl.google.com/go/go%s.src.tar.gz", version)
-	goFP := filepath.Join(root, version, fmt.Sprintf("go%s.src.tar.gz", version))
 
-	if _, err := os.Stat(filepath.Join(root, version, "go")); err != nil {
-		if err := os.MkdirAll(filepath.Join(root, version), 0755); err != nil {
-			return fmt.Errorf("failed to create source directory: %v", err)
+// checkNotInUse exits without removing anything if any of versions is in
+// use, saying why.
+func checkNotInUse(root string, versions ...string) {
+	busy := false
+	for _, v := range versions {
+		if why := gover.InUse(root, v); why != "" {
+			log.Printf("gover: not removing %s: %s", v, why)
+			busy = true
 		}
+	}
+	if busy {
+		log.Fatalf("gover: pass --force to remove it anyway")
+	}
+}
 
-		err := fetchify(goURL, goFP)
+// listFiles summarizes the files of the toolchain installed as name, listing
+// them all as a tree if asked to, and points out pieces missing from it.
+func listFiles(root, name string, tree bool) error {
+	name = gover.ReleaseVersion(name)
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid version %q", name)
+	}
+	// Follow aliases and installs elsewhere to the files themselves.
+	dir, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("version %s is not installed in %v", name, root)
+		}
+		return err
+	}
+	var files, dirs int
+	var size int64
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("failed to verify: %v", err)
+			log.Printf("cannot read %s: %v", p, err)
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		depth := strings.Count(rel, string(filepath.Separator))
+		label := d.Name()
+		if d.IsDir() {
+			dirs++
+			label += "/"
+		} else {
+			files++
+			if fi, err := d.Info(); err == nil && fi.Mode().IsRegular() {
+				size += fi.Size()
+				label += " (" + gover.HumanBytes(fi.Size()) + ")"
+			}
 		}
+		if tree && p != dir {
+			fmt.Printf("%s%s\n", strings.Repeat("  ", depth), label)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	fmt.Printf("Go %s in %s: %d files in %d directories, %s\n", name, dir, files, dirs-1, gover.HumanBytes(size))
 
-	cmd := exec.Command(filepath.Join(root, version, "go", "src", makeScript()))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = filepath.Join(root, version, "go", "src")
-	if runtime.GOOS == "windows" {
-		// Workaround make.bat not autodetecting GOROOT_BOOTSTRAP. Issue 28641.
-		goroot, err := exec.Command("go", "env", "GOROOT").Output()
-		if err != nil {
-			return fmt.Errorf("failed to detect an existing go installation for bootstrap: %v", err)
+	exe := gover.Exe()
+	if p, ok := gover.StagedPlatform(name); ok {
+		exe = ""
+		if strings.HasPrefix(p, "windows/") {
+			exe = ".exe"
 		}
-		cmd.Env = append(os.Environ(), "GOROOT_BOOTSTRAP="+strings.TrimSpace(string(goroot)))
 	}
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to build go: %v", err)
+	var problems []string
+	if fi, err := os.Stat(filepath.Join(dir, "go", "bin", "go"+exe)); err != nil || !fi.Mode().IsRegular() {
+		problems = append(problems, "go/bin/go"+exe+" is missing")
 	}
-	return nil
-}
-func makeScript() string {
-	switch runtime.GOOS {
-	case "plan9":
-		return "make.rc"
-	case "windows":
-		return "make.bat"
-	default:
-		return "make.bash"
+	if fi, err := os.Stat(filepath.Join(dir, "go", "src")); err != nil || !fi.IsDir() {
+		problems = append(problems, "go/src is missing")
 	}
+	if ents, err := os.ReadDir(filepath.Join(dir, "go", "pkg")); err != nil {
+		problems = append(problems, "go/pkg is missing")
+	} else if len(ents) == 0 {
+		problems = append(problems, "go/pkg is empty")
+	}
+	if !gover.IsInstalled(root, name) {
+		problems = append(problems, "the install was never completed, or was interrupted")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Printf("Problem: %s\n", p)
+	}
+	return fmt.Errorf("Go %s looks broken; 'gover reinstall %s' installs it afresh", name, name)
 }
 
-const caseInsensitiveEnv = runtime.GOOS == "windows"
-
-func exe() string {
-	if runtime.GOOS == "windows" {
-		return ".exe"
+// selfVersion describes the build of gover itself, as recorded by the go
+// command.
+func selfVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "gover (unknown version)"
 	}
-	return ""
-}
-func goroot(version string) (string, error) {
-	home, err := homedir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %v", err)
+	v := "gover " + bi.Main.Version
+	if bi.Main.Version == "" || bi.Main.Version == "(devel)" {
+		// Built from a checkout; say which one.
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				v += " " + s.Value
+			case "vcs.modified":
+				if s.Value == "true" {
+					v += "+dirty"
+				}
+			}
+		}
 	}
-	return filepath.Join(home, "sdk", version), nil
+	return v + " " + bi.GoVersion + " " + runtime.GOOS + "/" + runtime.GOARCH
 }
-func homedir() (string, error) {
-	// This could be replaced with os.UserHomeDir, but it was introduced too
-	// recently, and we want this to work with go as packaged by Linux
-	// distributions. Note that user.Current is not enough as it does not
-	// prioritize $HOME. See also Issue 26463.
-	switch runtime.GOOS {
-	case "plan9":
-		if dir := os.Getenv("home"); dir != "" {
-			return dir, nil
-		}
-		return "", errors.New("can't find user home directory; %USERPROFILE% is empty")
-	case "windows":
-		if dir := os.Getenv("USERPROFILE"); dir != "" {
-			return dir, nil
-		}
-		return "", errors.New("can't find user home directory; %USERPROFILE% is empty")
-	default:
-		if dir := os.Getenv("HOME"); dir != "" {
-			return dir, nil
+
+// flagValue returns the value given to the flag name in args, in any of the
+// forms the flag package accepts, before flags are parsed.
+func flagValue(args []string, name string) string {
+	for i, a := range args {
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		if a == name && i+1 < len(args) {
+			return args[i+1]
 		}
-		if u, err := user.Current(); err == nil && u.HomeDir != "" {
-			return u.HomeDir, nil
+		if strings.HasPrefix(a, name+"=") {
+			return strings.TrimPrefix(a, name+"=")
 		}
-		return "", errors.New("can't find user home directory; $HOME is empty")
 	}
+	return ""
 }
 
-// dedupEnv returns a copy of env with any duplicates removed, in favor of
-// later values.
-// Items are expected to be on the normal environment "key=value" form.
-// If caseInsensitive is true, the case of keys is ignored.
-//
-// This function is unnecessary when the binary is
-// built with Go 1.9+, but keep it around for now until Go 1.8
-// is no longer seen in the wild in common distros.
-//
-// This is copied verbatim from golang.org/x/build/envutil.Dedup at CL 10301
-// (commit a91ae26).
-func dedupEnv(caseInsensitive bool, env []string) []string {
-	out := make([]string, 0, len(env))
-	saw := map[string]int{} // to index in the array
-	for _, kv := range env {
-		eq := strings.Index(kv, "=")
-		if eq < 1 {
-			out = append(out, kv)
-			continue
-		}
-		k := kv[:eq]
-		if caseInsensitive {
-			k = strings.ToLower(k)
+// boolFlag reports whether the boolean flag name is set in args, for use
+// before the flags are parsed.
+func boolFlag(args []string, name string) bool {
+	for _, a := range args {
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		if a == name {
+			return true
 		}
-		if dupIdx, isDup := saw[k]; isDup {
-			out[dupIdx] = kv
-		} else {
-			saw[k] = len(out)
-			out = append(out, kv)
+		if strings.HasPrefix(a, name+"=") {
+			b, _ := strconv.ParseBool(strings.TrimPrefix(a, name+"="))
+			return b
 		}
 	}
-	return out
+	return false
+}
+
+// largeDownload is the size of archives above which gover asks before
+// downloading them.
+const largeDownload = 50 << 20
+
+// confirmDownload asks on the terminal whether to download archive if it
+// is larger than largeDownload.
+func confirmDownload(archive string, size int64) bool {
+	if size <= largeDownload {
+		return true
+	}
+	return confirm(fmt.Sprintf("%s is %s. Download it?", archive, gover.HumanBytes(size)))
+}
+
+// confirm asks question on the terminal and reports whether the answer
+// was yes.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	a := strings.ToLower(strings.TrimSpace(answer))
+	return a == "y" || a == "yes"
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestMain runs the test binary as gover itself when asked to by
+// GOVER_TEST_MAIN, for tests to run gover end to end.
+func TestMain(m *testing.M) {
+	if os.Getenv("GOVER_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeToolchain installs a toolchain for version under root whose go
+// command is the shell script script.
+func fakeToolchain(t *testing.T, root, version, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("fake toolchains are shell scripts")
+	}
+	gr := filepath.Join(root, version, "go")
+	for _, dir := range []string{filepath.Join(gr, "bin"), filepath.Join(gr, "src")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(gr, "bin", "go"), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunStreamsOutput(t *testing.T) {
+	root := t.TempDir()
+	fakeToolchain(t, root, "9.9.9", `exec cat "$GOVER_TEST_DATA"`)
+	// Several megabytes of arbitrary bytes, not just lines of text.
+	data := make([]byte, 8<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	file := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "9.9.9", "test", "-json")
+	cmd.Env = append(os.Environ(), "GOVER_TEST_MAIN=1", "GOVER_ROOT="+root, "GOVER_TEST_DATA="+file)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("gover: %v\n%s", err, stderr.Bytes())
+	}
+	if !bytes.Equal(stdout.Bytes(), data) {
+		t.Errorf("gover wrote %d bytes differing from the %d the toolchain wrote", stdout.Len(), len(data))
+	}
+}